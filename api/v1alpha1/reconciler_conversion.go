@@ -0,0 +1,189 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1alpha1
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// conversionDataAnnotation preserves the v1beta1 fields that can't be
+// represented in v1alpha1, so that round trips are lossless.
+const conversionDataAnnotation = "ytt-operator.pecke.tt/v1beta1-conversion-data"
+
+type conversionData struct {
+	// For is only kept if any of the bindings have a selector or definition.
+	For []v1beta1.ReconcilerForSpec `json:"for,omitempty"`
+	// Content lists the scripts that were given as plain text.
+	Content []string `json:"content,omitempty"`
+	// RBAC has no v1alpha1 equivalent.
+	RBAC *v1beta1.ReconcilerRBACSpec `json:"rbac,omitempty"`
+	// Mode has no v1alpha1 equivalent.
+	Mode v1beta1.ReconcilerMode `json:"mode,omitempty"`
+	// Approval has no v1alpha1 equivalent.
+	Approval *v1beta1.ReconcilerApprovalSpec `json:"approval,omitempty"`
+	// PlanTimeout has no v1alpha1 equivalent.
+	PlanTimeout *metav1.Duration `json:"planTimeout,omitempty"`
+}
+
+var _ conversion.Convertible = &Reconciler{}
+
+// ConvertTo converts this Reconciler to the hub version (v1beta1).
+func (src *Reconciler) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.Reconciler)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+
+	var data conversionData
+	if raw, ok := dst.Annotations[conversionDataAnnotation]; ok {
+		if err := json.Unmarshal([]byte(raw), &data); err != nil {
+			return fmt.Errorf("failed to parse %s annotation: %w", conversionDataAnnotation, err)
+		}
+
+		delete(dst.Annotations, conversionDataAnnotation)
+		if len(dst.Annotations) == 0 {
+			dst.Annotations = nil
+		}
+	}
+
+	dst.Spec.For = nil
+	for i, t := range src.Spec.For {
+		binding := v1beta1.ReconcilerForSpec{APIVersion: t.APIVersion, Kind: t.Kind}
+		// Only restore selectors if the kinds haven't since been changed.
+		if len(data.For) == len(src.Spec.For) && data.For[i].APIVersion == t.APIVersion && data.For[i].Kind == t.Kind {
+			binding.Selector = data.For[i].Selector
+			binding.Definition = data.For[i].Definition
+		}
+
+		dst.Spec.For = append(dst.Spec.For, binding)
+	}
+
+	content := make(map[string]bool, len(data.Content))
+	for _, name := range data.Content {
+		content[name] = true
+	}
+
+	dst.Spec.Scripts = nil
+	for _, s := range src.Spec.Scripts {
+		script := v1beta1.ReconcilerScriptSpec{Name: s.Name, Encoded: s.Encoded, Mode: s.Mode}
+		if content[s.Name] {
+			if decoded, err := base64.StdEncoding.DecodeString(s.Encoded); err == nil {
+				script.Content, script.Encoded = string(decoded), ""
+			}
+		}
+
+		dst.Spec.Scripts = append(dst.Spec.Scripts, script)
+	}
+
+	dst.Spec.ServiceAccountName = src.Spec.ServiceAccountName
+	dst.Spec.Namespaces = src.Spec.Namespaces
+	dst.Spec.NamespaceSelector = src.Spec.NamespaceSelector
+	dst.Spec.Selector = src.Spec.Selector
+	dst.Spec.MaxConcurrentReconciles = src.Spec.MaxConcurrentReconciles
+	dst.Spec.RateLimit = (*v1beta1.ReconcilerRateLimitSpec)(src.Spec.RateLimit)
+	dst.Spec.Timeouts = nil
+	if t := src.Spec.Timeouts; t != nil {
+		dst.Spec.Timeouts = &v1beta1.ReconcilerTimeoutsSpec{Render: t.Render, Deploy: t.Deploy, Delete: t.Delete, KappWait: t.KappWait}
+	}
+	if data.PlanTimeout != nil {
+		if dst.Spec.Timeouts == nil {
+			dst.Spec.Timeouts = &v1beta1.ReconcilerTimeoutsSpec{}
+		}
+		dst.Spec.Timeouts.Plan = data.PlanTimeout
+	}
+	dst.Spec.Suspend = src.Spec.Suspend
+	dst.Spec.DeletionPolicy = v1beta1.DeletionPolicy(src.Spec.DeletionPolicy)
+	dst.Spec.DeletionDeadline = src.Spec.DeletionDeadline
+	dst.Spec.Safety = (*v1beta1.ReconcilerSafetySpec)(src.Spec.Safety)
+	dst.Spec.SensitiveFields = src.Spec.SensitiveFields
+	dst.Spec.RBAC = data.RBAC
+	dst.Spec.Mode = data.Mode
+	dst.Spec.Approval = data.Approval
+
+	dst.Status = v1beta1.ReconcilerStatus(src.Status)
+
+	return nil
+}
+
+// ConvertFrom converts from the hub version (v1beta1) to this version.
+func (dst *Reconciler) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.Reconciler)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+
+	data := conversionData{RBAC: src.Spec.RBAC, Mode: src.Spec.Mode, Approval: src.Spec.Approval}
+	if src.Spec.Timeouts != nil {
+		data.PlanTimeout = src.Spec.Timeouts.Plan
+	}
+
+	dst.Spec.For = nil
+	for _, binding := range src.Spec.For {
+		dst.Spec.For = append(dst.Spec.For, metav1.TypeMeta{APIVersion: binding.APIVersion, Kind: binding.Kind})
+
+		if binding.Selector != nil || binding.Definition != nil {
+			data.For = src.Spec.For
+		}
+	}
+
+	dst.Spec.Scripts = nil
+	for _, s := range src.Spec.Scripts {
+		script := ReconcilerScriptSpec{Name: s.Name, Encoded: s.Encoded, Mode: s.Mode}
+		if s.Content != "" {
+			script.Encoded = base64.StdEncoding.EncodeToString([]byte(s.Content))
+			data.Content = append(data.Content, s.Name)
+		}
+
+		dst.Spec.Scripts = append(dst.Spec.Scripts, script)
+	}
+
+	if len(data.For) > 0 || len(data.Content) > 0 || data.RBAC != nil || data.Mode != "" || data.Approval != nil || data.PlanTimeout != nil {
+		raw, err := json.Marshal(&data)
+		if err != nil {
+			return fmt.Errorf("failed to marshal conversion data: %w", err)
+		}
+
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[conversionDataAnnotation] = string(raw)
+	}
+
+	dst.Spec.ServiceAccountName = src.Spec.ServiceAccountName
+	dst.Spec.Namespaces = src.Spec.Namespaces
+	dst.Spec.NamespaceSelector = src.Spec.NamespaceSelector
+	dst.Spec.Selector = src.Spec.Selector
+	dst.Spec.MaxConcurrentReconciles = src.Spec.MaxConcurrentReconciles
+	dst.Spec.RateLimit = (*ReconcilerRateLimitSpec)(src.Spec.RateLimit)
+	dst.Spec.Timeouts = nil
+	if t := src.Spec.Timeouts; t != nil {
+		dst.Spec.Timeouts = &ReconcilerTimeoutsSpec{Render: t.Render, Deploy: t.Deploy, Delete: t.Delete, KappWait: t.KappWait}
+	}
+	dst.Spec.Suspend = src.Spec.Suspend
+	dst.Spec.DeletionPolicy = DeletionPolicy(src.Spec.DeletionPolicy)
+	dst.Spec.DeletionDeadline = src.Spec.DeletionDeadline
+	dst.Spec.Safety = (*ReconcilerSafetySpec)(src.Spec.Safety)
+	dst.Spec.SensitiveFields = src.Spec.SensitiveFields
+
+	dst.Status = ReconcilerStatus(src.Status)
+
+	return nil
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReconcilerConversion(t *testing.T) {
+	hub := &v1beta1.Reconciler{
+		ObjectMeta: metav1.ObjectMeta{Name: "databases", Namespace: "default"},
+		Spec: v1beta1.ReconcilerSpec{
+			ServiceAccountName: "databases",
+			For: []v1beta1.ReconcilerForSpec{{
+				APIVersion: "example.com/v1",
+				Kind:       "Database",
+				Selector:   &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "gold"}},
+				Definition: &v1beta1.ReconcilerDefinitionSpec{ShortNames: []string{"db"}},
+			}},
+			Scripts: []v1beta1.ReconcilerScriptSpec{
+				{Name: "config.yaml", Content: "#@ load(\"@ytt:data\", \"data\")\n"},
+				{Name: "values.yaml", Encoded: "Zm9vOiBiYXIK"},
+			},
+			DeletionPolicy: v1beta1.DeletionPolicyOrphan,
+			RBAC: &v1beta1.ReconcilerRBACSpec{
+				Generate: true,
+				Outputs:  []v1beta1.ReconcilerKindSpec{{APIVersion: "v1", Kind: "ConfigMap"}},
+			},
+			Mode:     v1beta1.ReconcilerModeObserve,
+			Approval: &v1beta1.ReconcilerApprovalSpec{Deletes: true, Kinds: []string{"PersistentVolumeClaim"}},
+			Timeouts: &v1beta1.ReconcilerTimeoutsSpec{
+				Render: &metav1.Duration{Duration: time.Minute},
+				Plan:   &metav1.Duration{Duration: 2 * time.Minute},
+			},
+		},
+	}
+
+	var spoke Reconciler
+	require.NoError(t, spoke.ConvertFrom(hub))
+
+	assert.Equal(t, []metav1.TypeMeta{{APIVersion: "example.com/v1", Kind: "Database"}}, spoke.Spec.For)
+	assert.Equal(t, "I0AgbG9hZCgiQHl0dDpkYXRhIiwgImRhdGEiKQo=", spoke.Spec.Scripts[0].Encoded)
+	assert.Equal(t, DeletionPolicyOrphan, spoke.Spec.DeletionPolicy)
+	assert.Equal(t, &ReconcilerTimeoutsSpec{Render: &metav1.Duration{Duration: time.Minute}}, spoke.Spec.Timeouts)
+
+	var roundTripped v1beta1.Reconciler
+	require.NoError(t, spoke.ConvertTo(&roundTripped))
+
+	assert.Equal(t, hub, &roundTripped, "Round trip should be lossless")
+
+	t.Run("Changed kinds", func(t *testing.T) {
+		changed := spoke.DeepCopy()
+		changed.Spec.For[0].Kind = "Cache"
+
+		var dst v1beta1.Reconciler
+		require.NoError(t, changed.ConvertTo(&dst))
+
+		assert.Nil(t, dst.Spec.For[0].Selector, "Selectors shouldn't be restored onto a different kind")
+	})
+}
@@ -17,18 +17,81 @@
 package v1alpha1
 
 import (
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 type ReconcilerScriptSpec struct {
-	// Name is the name of the script.
+	// Name is the path of the script, relative to the scripts directory.
+	// It may include subdirectories (eg. lib/helpers.star), but must not
+	// be absolute or contain ".." elements. Any file type understood by ytt
+	// can be used (eg. YAML templates, Starlark modules, text templates).
 	Name string `json:"name"`
 	// Encoded is a base64 encoded string of the script. We use
 	// base64 encoding here to prevent issues with ytt markers in
 	// the script getting prematurely evaluated.
 	Encoded string `json:"encoded"`
+	// Mode is the file mode of the script (default 0644).
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=511
+	Mode *int32 `json:"mode,omitempty"`
 }
 
+// ReconcilerRateLimitSpec configures how quickly objects are reconciled.
+type ReconcilerRateLimitSpec struct {
+	// BaseDelay is the initial backoff after a failed reconcile (default 5ms).
+	BaseDelay *metav1.Duration `json:"baseDelay,omitempty"`
+	// MaxDelay is the maximum backoff after repeated failed reconciles (default 1000s).
+	MaxDelay *metav1.Duration `json:"maxDelay,omitempty"`
+	// QPS is the overall number of reconciles allowed per second (default 10).
+	// +kubebuilder:validation:Minimum=1
+	QPS int32 `json:"qps,omitempty"`
+	// Burst is the bucket size of the overall rate limit (default 100).
+	// +kubebuilder:validation:Minimum=1
+	Burst int32 `json:"burst,omitempty"`
+}
+
+// ReconcilerTimeoutsSpec configures how long each stage of a reconcile may take.
+type ReconcilerTimeoutsSpec struct {
+	// Render is the maximum time ytt may take to render the templates.
+	Render *metav1.Duration `json:"render,omitempty"`
+	// Deploy is the maximum time kapp may take to deploy the rendered resources.
+	Deploy *metav1.Duration `json:"deploy,omitempty"`
+	// Delete is the maximum time kapp may take to delete an objects resources.
+	Delete *metav1.Duration `json:"delete,omitempty"`
+	// KappWait is passed through to kapp as --wait-timeout.
+	KappWait *metav1.Duration `json:"kappWait,omitempty"`
+}
+
+// ReconcilerSafetySpec guards against template bugs deleting resources.
+type ReconcilerSafetySpec struct {
+	// AllowEmptyRender allows renders that produce no resources to be
+	// deployed, which will delete all of an objects existing resources.
+	AllowEmptyRender bool `json:"allowEmptyRender,omitempty"`
+	// MaxDeletePercent is the maximum percentage of an objects existing
+	// resources that may be deleted by a single deploy.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	MaxDeletePercent *int32 `json:"maxDeletePercent,omitempty"`
+	// MaxDeleteCount is the maximum number of resources that may be deleted
+	// by a single deploy.
+	// +kubebuilder:validation:Minimum=0
+	MaxDeleteCount *int32 `json:"maxDeleteCount,omitempty"`
+}
+
+// DeletionPolicy determines what happens to the resources generated for an
+// object when it is deleted.
+// +kubebuilder:validation:Enum=Delete;Orphan
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes the generated resources (the default).
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyOrphan leaves the generated resources in place, but
+	// removes the kapp app record and ownership labels.
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
+)
+
 // ReconcilerSpec defines the desired state of Reconciler
 type ReconcilerSpec struct {
 	// ServiceAccountName is the name of the service account to use for the reconciler.
@@ -37,14 +100,63 @@ type ReconcilerSpec struct {
 	For []metav1.TypeMeta `json:"for,omitempty"`
 	// Scripts is a list of scripts to execute for this reconciler.
 	Scripts []ReconcilerScriptSpec `json:"scripts,omitempty"`
+	// Namespaces restricts the reconciler to objects in the listed namespaces.
+	// If empty, objects in all namespaces are reconciled.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// NamespaceSelector restricts the reconciler to objects in namespaces
+	// whose labels match the selector.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// Selector restricts the reconciler to objects whose labels match the selector.
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// MaxConcurrentReconciles is the maximum number of objects of each kind
+	// that will be reconciled concurrently (default 1).
+	// +kubebuilder:validation:Minimum=1
+	MaxConcurrentReconciles int32 `json:"maxConcurrentReconciles,omitempty"`
+	// RateLimit configures failure backoff and the overall reconcile rate.
+	RateLimit *ReconcilerRateLimitSpec `json:"rateLimit,omitempty"`
+	// Timeouts configures the maximum duration of each stage of a reconcile.
+	Timeouts *ReconcilerTimeoutsSpec `json:"timeouts,omitempty"`
+	// Suspend stops the reconciler from rendering, deploying or deleting
+	// resources. Finalizers are left in place until it is resumed.
+	Suspend bool `json:"suspend,omitempty"`
+	// DeletionPolicy determines what happens to the generated resources when
+	// an object is deleted. It can be overridden per object with the
+	// ytt-operator.pecke.tt/deletion-policy annotation.
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// DeletionDeadline is how long to keep retrying the clean up of a deleted
+	// objects resources before giving up and removing the finalizer anyway.
+	// If unset, clean up will be retried forever.
+	DeletionDeadline *metav1.Duration `json:"deletionDeadline,omitempty"`
+	// Safety configures limits on destructive deploys. Deploys that exceed
+	// them are blocked until approved with the
+	// ytt-operator.pecke.tt/approved-plan annotation.
+	Safety *ReconcilerSafetySpec `json:"safety,omitempty"`
+	// SensitiveFields are additional field paths (eg. spec.password) that
+	// are masked in rendered manifests before they are logged. A "*" matches
+	// any key or list element. Secret data and stringData are always masked.
+	SensitiveFields []string `json:"sensitiveFields,omitempty"`
 }
 
 // ReconcilerStatus defines the observed state of Reconciler
 type ReconcilerStatus struct {
+	// Conditions describe the current state of the reconciler.
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// RemainingObjects is the number of objects that still need to be
+	// released before a deleted reconciler can be removed.
+	RemainingObjects int32 `json:"remainingObjects,omitempty"`
+	// PendingKinds are the for kinds that aren't installed in the cluster
+	// yet, the child starts reconciling them once they are.
+	PendingKinds []string `json:"pendingKinds,omitempty"`
+	// PendingChanges are the changes that reconciling objects would make, in
+	// the Observe mode (v1beta1 only). Objects without changes aren't listed.
+	PendingChanges []v1beta1.ReconcilerPendingChange `json:"pendingChanges,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:deprecatedversion:warning="ytt-operator.pecke.tt/v1alpha1 Reconciler is deprecated, use ytt-operator.pecke.tt/v1beta1"
 
 // Reconciler is the Schema for the reconcilers API
 type Reconciler struct {
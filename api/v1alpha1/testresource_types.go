@@ -25,6 +25,9 @@ type TestResourceSpec struct {
 }
 
 type TestResourceStatus struct {
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -22,6 +22,7 @@
 package v1alpha1
 
 import (
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
@@ -32,7 +33,7 @@ func (in *Reconciler) DeepCopyInto(out *Reconciler) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Reconciler.
@@ -85,9 +86,64 @@ func (in *ReconcilerList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReconcilerRateLimitSpec) DeepCopyInto(out *ReconcilerRateLimitSpec) {
+	*out = *in
+	if in.BaseDelay != nil {
+		in, out := &in.BaseDelay, &out.BaseDelay
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.MaxDelay != nil {
+		in, out := &in.MaxDelay, &out.MaxDelay
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReconcilerRateLimitSpec.
+func (in *ReconcilerRateLimitSpec) DeepCopy() *ReconcilerRateLimitSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReconcilerRateLimitSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReconcilerSafetySpec) DeepCopyInto(out *ReconcilerSafetySpec) {
+	*out = *in
+	if in.MaxDeletePercent != nil {
+		in, out := &in.MaxDeletePercent, &out.MaxDeletePercent
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxDeleteCount != nil {
+		in, out := &in.MaxDeleteCount, &out.MaxDeleteCount
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReconcilerSafetySpec.
+func (in *ReconcilerSafetySpec) DeepCopy() *ReconcilerSafetySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReconcilerSafetySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ReconcilerScriptSpec) DeepCopyInto(out *ReconcilerScriptSpec) {
 	*out = *in
+	if in.Mode != nil {
+		in, out := &in.Mode, &out.Mode
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReconcilerScriptSpec.
@@ -111,6 +167,48 @@ func (in *ReconcilerSpec) DeepCopyInto(out *ReconcilerSpec) {
 	if in.Scripts != nil {
 		in, out := &in.Scripts, &out.Scripts
 		*out = make([]ReconcilerScriptSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RateLimit != nil {
+		in, out := &in.RateLimit, &out.RateLimit
+		*out = new(ReconcilerRateLimitSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Timeouts != nil {
+		in, out := &in.Timeouts, &out.Timeouts
+		*out = new(ReconcilerTimeoutsSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DeletionDeadline != nil {
+		in, out := &in.DeletionDeadline, &out.DeletionDeadline
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Safety != nil {
+		in, out := &in.Safety, &out.Safety
+		*out = new(ReconcilerSafetySpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SensitiveFields != nil {
+		in, out := &in.SensitiveFields, &out.SensitiveFields
+		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
 }
@@ -128,6 +226,23 @@ func (in *ReconcilerSpec) DeepCopy() *ReconcilerSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ReconcilerStatus) DeepCopyInto(out *ReconcilerStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PendingKinds != nil {
+		in, out := &in.PendingKinds, &out.PendingKinds
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PendingChanges != nil {
+		in, out := &in.PendingChanges, &out.PendingChanges
+		*out = make([]v1beta1.ReconcilerPendingChange, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReconcilerStatus.
@@ -140,13 +255,48 @@ func (in *ReconcilerStatus) DeepCopy() *ReconcilerStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReconcilerTimeoutsSpec) DeepCopyInto(out *ReconcilerTimeoutsSpec) {
+	*out = *in
+	if in.Render != nil {
+		in, out := &in.Render, &out.Render
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Deploy != nil {
+		in, out := &in.Deploy, &out.Deploy
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Delete != nil {
+		in, out := &in.Delete, &out.Delete
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.KappWait != nil {
+		in, out := &in.KappWait, &out.KappWait
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReconcilerTimeoutsSpec.
+func (in *ReconcilerTimeoutsSpec) DeepCopy() *ReconcilerTimeoutsSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReconcilerTimeoutsSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TestResource) DeepCopyInto(out *TestResource) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TestResource.
@@ -217,6 +367,13 @@ func (in *TestResourceSpec) DeepCopy() *TestResourceSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TestResourceStatus) DeepCopyInto(out *TestResourceStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TestResourceStatus.
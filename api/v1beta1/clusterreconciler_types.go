@@ -0,0 +1,76 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterReconcilerSpec defines the desired state of ClusterReconciler
+type ClusterReconcilerSpec struct {
+	ReconcilerSpec `json:",inline"`
+	// Namespace is the namespace the child reconciler runs in. The service
+	// account must exist in this namespace, and kapp app records for the
+	// reconciled objects are kept here.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="namespace is immutable"
+	Namespace string `json:"namespace"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+
+// ClusterReconciler is the Schema for the clusterreconcilers API. It is a
+// cluster scoped Reconciler, for operators that aren't owned by any one
+// namespace (or that reconcile cluster scoped kinds).
+type ClusterReconciler struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterReconcilerSpec `json:"spec,omitempty"`
+	Status ReconcilerStatus      `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterReconcilerList contains a list of ClusterReconciler
+type ClusterReconcilerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterReconciler `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterReconciler{}, &ClusterReconcilerList{})
+}
+
+// GetReconcilerSpec returns the reconciler configuration.
+func (r *ClusterReconciler) GetReconcilerSpec() *ReconcilerSpec {
+	return &r.Spec.ReconcilerSpec
+}
+
+// GetReconcilerStatus returns the reconciler status.
+func (r *ClusterReconciler) GetReconcilerStatus() *ReconcilerStatus {
+	return &r.Status
+}
+
+// GetWatchedNamespaces returns the namespaces the reconciler acts on, or nil
+// for every namespace.
+func (r *ClusterReconciler) GetWatchedNamespaces() []string {
+	return r.Spec.Namespaces
+}
@@ -0,0 +1,338 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1beta1
+
+import (
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type ReconcilerScriptSpec struct {
+	// Name is the path of the script, relative to the scripts directory.
+	// It may include subdirectories (eg. lib/helpers.star), but must not
+	// be absolute or contain ".." elements. Any file type understood by ytt
+	// can be used (eg. YAML templates, Starlark modules, text templates).
+	Name string `json:"name"`
+	// Content is the plain text of the script. Exactly one of content or
+	// encoded must be set.
+	Content string `json:"content,omitempty"`
+	// Encoded is a base64 encoded string of the script, for scripts that
+	// aren't valid UTF-8 (or for compatibility with v1alpha1).
+	Encoded string `json:"encoded,omitempty"`
+	// Mode is the file mode of the script (default 0644).
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=511
+	Mode *int32 `json:"mode,omitempty"`
+}
+
+// ReconcilerForSpec binds the reconciler to a kind of object.
+type ReconcilerForSpec struct {
+	// APIVersion is the group/version of the kind (eg. example.com/v1).
+	APIVersion string `json:"apiVersion"`
+	// Kind is the kind of object to reconcile.
+	Kind string `json:"kind"`
+	// Selector restricts the reconciler to objects of this kind whose labels
+	// match the selector (in addition to the reconcilers own selector).
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// Definition describes the CustomResourceDefinition of the kind. If set,
+	// the CRD is created (and upgraded) along with the reconciler.
+	Definition *ReconcilerDefinitionSpec `json:"definition,omitempty"`
+}
+
+// GroupVersionKind returns the GroupVersionKind of the bound kind.
+func (f ReconcilerForSpec) GroupVersionKind() schema.GroupVersionKind {
+	return schema.FromAPIVersionAndKind(f.APIVersion, f.Kind)
+}
+
+// Plural returns the plural resource name of a defined kind.
+func (f ReconcilerForSpec) Plural() string {
+	if f.Definition != nil && f.Definition.Plural != "" {
+		return f.Definition.Plural
+	}
+
+	return strings.ToLower(f.Kind) + "s"
+}
+
+// ReconcilerDefinitionSpec describes the CustomResourceDefinition of a kind.
+type ReconcilerDefinitionSpec struct {
+	// Plural is the plural resource name of the kind (default: the lowercase
+	// kind with an "s" appended).
+	Plural string `json:"plural,omitempty"`
+	// ShortNames are short aliases for the resource (eg. for kubectl get).
+	ShortNames []string `json:"shortNames,omitempty"`
+	// Scope is whether objects of the kind are Namespaced (the default) or
+	// Cluster scoped. It can't be changed once the CRD has been created.
+	// +kubebuilder:validation:Enum=Namespaced;Cluster
+	Scope apiextensionsv1.ResourceScope `json:"scope,omitempty"`
+	// Schema is the OpenAPI v3 schema of the kind. If unset, objects may
+	// have any fields. A status field is added if the schema doesn't have
+	// one, so that conditions can be reported.
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Schema *apiextensionsv1.JSONSchemaProps `json:"schema,omitempty"`
+	// PrinterColumns are additional columns shown by kubectl get.
+	PrinterColumns []apiextensionsv1.CustomResourceColumnDefinition `json:"printerColumns,omitempty"`
+}
+
+// ReconcilerRateLimitSpec configures how quickly objects are reconciled.
+type ReconcilerRateLimitSpec struct {
+	// BaseDelay is the initial backoff after a failed reconcile (default 5ms).
+	BaseDelay *metav1.Duration `json:"baseDelay,omitempty"`
+	// MaxDelay is the maximum backoff after repeated failed reconciles (default 1000s).
+	MaxDelay *metav1.Duration `json:"maxDelay,omitempty"`
+	// QPS is the overall number of reconciles allowed per second (default 10).
+	// +kubebuilder:validation:Minimum=1
+	QPS int32 `json:"qps,omitempty"`
+	// Burst is the bucket size of the overall rate limit (default 100).
+	// +kubebuilder:validation:Minimum=1
+	Burst int32 `json:"burst,omitempty"`
+}
+
+// ReconcilerTimeoutsSpec configures how long each stage of a reconcile may take.
+type ReconcilerTimeoutsSpec struct {
+	// Render is the maximum time ytt may take to render the templates.
+	Render *metav1.Duration `json:"render,omitempty"`
+	// Plan is the maximum time kapp may take to work out the changes a
+	// deploy would make (when safety limits or approvals need them).
+	Plan *metav1.Duration `json:"plan,omitempty"`
+	// Deploy is the maximum time kapp may take to deploy the rendered resources.
+	Deploy *metav1.Duration `json:"deploy,omitempty"`
+	// Delete is the maximum time kapp may take to delete an objects resources.
+	Delete *metav1.Duration `json:"delete,omitempty"`
+	// KappWait is passed through to kapp as --wait-timeout.
+	KappWait *metav1.Duration `json:"kappWait,omitempty"`
+}
+
+// ReconcilerSafetySpec guards against template bugs deleting resources.
+type ReconcilerSafetySpec struct {
+	// AllowEmptyRender allows renders that produce no resources to be
+	// deployed, which will delete all of an objects existing resources.
+	AllowEmptyRender bool `json:"allowEmptyRender,omitempty"`
+	// MaxDeletePercent is the maximum percentage of an objects existing
+	// resources that may be deleted by a single deploy.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	MaxDeletePercent *int32 `json:"maxDeletePercent,omitempty"`
+	// MaxDeleteCount is the maximum number of resources that may be deleted
+	// by a single deploy.
+	// +kubebuilder:validation:Minimum=0
+	MaxDeleteCount *int32 `json:"maxDeleteCount,omitempty"`
+}
+
+// ReconcilerApprovalSpec selects the changes that must be approved by a
+// person before they are deployed.
+type ReconcilerApprovalSpec struct {
+	// Deletes requires approval for deploys that delete resources.
+	Deletes bool `json:"deletes,omitempty"`
+	// Replacements requires approval for deploys that replace resources
+	// rather than updating them in place (eg. to change an immutable field
+	// using kapps update-strategy annotation).
+	Replacements bool `json:"replacements,omitempty"`
+	// Kinds requires approval for any change to resources of the listed
+	// kinds (eg. PersistentVolumeClaim).
+	Kinds []string `json:"kinds,omitempty"`
+}
+
+// ReconcilerKindSpec identifies a kind of object.
+type ReconcilerKindSpec struct {
+	// APIVersion is the group/version of the kind (eg. apps/v1).
+	APIVersion string `json:"apiVersion"`
+	// Kind is the name of the kind (eg. Deployment).
+	Kind string `json:"kind"`
+}
+
+// GroupVersionKind returns the GroupVersionKind of the kind.
+func (k ReconcilerKindSpec) GroupVersionKind() schema.GroupVersionKind {
+	return schema.FromAPIVersionAndKind(k.APIVersion, k.Kind)
+}
+
+// ReconcilerRBACSpec configures the generation of a least privilege service
+// account for the reconcilers child.
+type ReconcilerRBACSpec struct {
+	// Generate creates a service account for the child (named after it),
+	// along with the roles and bindings needed to reconcile the for kinds
+	// and to deploy the output kinds. ServiceAccountName must be empty.
+	Generate bool `json:"generate,omitempty"`
+	// Outputs are the kinds of resources rendered by the scripts.
+	Outputs []ReconcilerKindSpec `json:"outputs,omitempty"`
+}
+
+// DeletionPolicy determines what happens to the resources generated for an
+// object when it is deleted.
+// +kubebuilder:validation:Enum=Delete;Orphan
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes the generated resources (the default).
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyOrphan leaves the generated resources in place, but
+	// removes the kapp app record and ownership labels.
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
+)
+
+// ReconcilerMode determines whether a reconciler makes any changes.
+// +kubebuilder:validation:Enum=Apply;Observe
+type ReconcilerMode string
+
+const (
+	// ReconcilerModeApply deploys the rendered manifests (the default).
+	ReconcilerModeApply ReconcilerMode = "Apply"
+	// ReconcilerModeObserve only works out what deploying the rendered
+	// manifests would change, without changing anything.
+	ReconcilerModeObserve ReconcilerMode = "Observe"
+)
+
+// ReconcilerPendingChange describes what reconciling an object would change.
+type ReconcilerPendingChange struct {
+	// APIVersion is the group/version of the object.
+	APIVersion string `json:"apiVersion"`
+	// Kind is the kind of the object.
+	Kind string `json:"kind"`
+	// Namespace is the namespace of the object (if namespaced).
+	Namespace string `json:"namespace,omitempty"`
+	// Name is the name of the object.
+	Name string `json:"name"`
+	// Plan is the hash of the planned changes.
+	Plan string `json:"plan"`
+	// Summary describes the planned changes.
+	Summary string `json:"summary"`
+}
+
+// ReconcilerSpec defines the desired state of Reconciler
+type ReconcilerSpec struct {
+	// ServiceAccountName is the name of the service account to use for the
+	// reconciler. It must be empty if RBAC is generated.
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// For is the list of kinds to reconcile.
+	For []ReconcilerForSpec `json:"for,omitempty"`
+	// Scripts is a list of scripts to execute for this reconciler.
+	Scripts []ReconcilerScriptSpec `json:"scripts,omitempty"`
+	// Namespaces restricts the reconciler to objects in the listed namespaces.
+	// If empty, objects in all namespaces are reconciled.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// NamespaceSelector restricts the reconciler to objects in namespaces
+	// whose labels match the selector.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// Selector restricts the reconciler to objects whose labels match the selector.
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// MaxConcurrentReconciles is the maximum number of objects of each kind
+	// that will be reconciled concurrently (default 1).
+	// +kubebuilder:validation:Minimum=1
+	MaxConcurrentReconciles int32 `json:"maxConcurrentReconciles,omitempty"`
+	// RateLimit configures failure backoff and the overall reconcile rate.
+	RateLimit *ReconcilerRateLimitSpec `json:"rateLimit,omitempty"`
+	// Timeouts configures the maximum duration of each stage of a reconcile.
+	Timeouts *ReconcilerTimeoutsSpec `json:"timeouts,omitempty"`
+	// Suspend stops the reconciler from rendering, deploying or deleting
+	// resources. Finalizers are left in place until it is resumed.
+	Suspend bool `json:"suspend,omitempty"`
+	// DeletionPolicy determines what happens to the generated resources when
+	// an object is deleted. It can be overridden per object with the
+	// ytt-operator.pecke.tt/deletion-policy annotation.
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// DeletionDeadline is how long to keep retrying the clean up of a deleted
+	// objects resources before giving up and removing the finalizer anyway.
+	// If unset, clean up will be retried forever.
+	DeletionDeadline *metav1.Duration `json:"deletionDeadline,omitempty"`
+	// Safety configures limits on destructive deploys. Deploys that exceed
+	// them are blocked until approved with the
+	// ytt-operator.pecke.tt/approved-plan annotation.
+	Safety *ReconcilerSafetySpec `json:"safety,omitempty"`
+	// SensitiveFields are additional field paths (eg. spec.password) that
+	// are masked in rendered manifests before they are logged. A "*" matches
+	// any key or list element. Secret data and stringData are always masked.
+	SensitiveFields []string `json:"sensitiveFields,omitempty"`
+	// RBAC configures the generation of the reconcilers service account
+	// and permissions.
+	RBAC *ReconcilerRBACSpec `json:"rbac,omitempty"`
+	// Mode is either Apply (the default), or Observe to render and diff
+	// objects without changing anything (including the objects themselves).
+	// Pending changes are reported in the status and as events.
+	Mode ReconcilerMode `json:"mode,omitempty"`
+	// Approval configures which changes must be approved before they are
+	// deployed. Such deploys are blocked until approved with the
+	// ytt-operator.pecke.tt/approved-plan annotation.
+	Approval *ReconcilerApprovalSpec `json:"approval,omitempty"`
+}
+
+// ReconcilerStatus defines the observed state of Reconciler
+type ReconcilerStatus struct {
+	// Conditions describe the current state of the reconciler.
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// RemainingObjects is the number of objects that still need to be
+	// released before a deleted reconciler can be removed.
+	RemainingObjects int32 `json:"remainingObjects,omitempty"`
+	// PendingKinds are the for kinds that aren't installed in the cluster
+	// yet, the child starts reconciling them once they are.
+	PendingKinds []string `json:"pendingKinds,omitempty"`
+	// PendingChanges are the changes that reconciling objects would make, in
+	// the Observe mode. Objects without changes aren't listed.
+	PendingChanges []ReconcilerPendingChange `json:"pendingChanges,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+
+// Reconciler is the Schema for the reconcilers API
+type Reconciler struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ReconcilerSpec   `json:"spec,omitempty"`
+	Status ReconcilerStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ReconcilerList contains a list of Reconciler
+type ReconcilerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Reconciler `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Reconciler{}, &ReconcilerList{})
+}
+
+// GetReconcilerSpec returns the reconciler configuration.
+func (r *Reconciler) GetReconcilerSpec() *ReconcilerSpec {
+	return &r.Spec
+}
+
+// GetReconcilerStatus returns the reconciler status.
+func (r *Reconciler) GetReconcilerStatus() *ReconcilerStatus {
+	return &r.Status
+}
+
+// GetWatchedNamespaces returns the namespaces the reconciler acts on, or nil
+// for every namespace. Generated RBAC never reaches beyond the reconcilers
+// own namespace, unless others are listed.
+func (r *Reconciler) GetWatchedNamespaces() []string {
+	if len(r.Spec.Namespaces) == 0 && r.Spec.RBAC != nil && r.Spec.RBAC.Generate {
+		return []string{r.Namespace}
+	}
+
+	return r.Spec.Namespaces
+}
@@ -0,0 +1,507 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Code generated by controller-gen. DO NOT EDIT.
+
+package v1beta1
+
+import (
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterReconciler) DeepCopyInto(out *ClusterReconciler) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterReconciler.
+func (in *ClusterReconciler) DeepCopy() *ClusterReconciler {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterReconciler)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterReconciler) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterReconcilerList) DeepCopyInto(out *ClusterReconcilerList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterReconciler, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterReconcilerList.
+func (in *ClusterReconcilerList) DeepCopy() *ClusterReconcilerList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterReconcilerList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterReconcilerList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterReconcilerSpec) DeepCopyInto(out *ClusterReconcilerSpec) {
+	*out = *in
+	in.ReconcilerSpec.DeepCopyInto(&out.ReconcilerSpec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterReconcilerSpec.
+func (in *ClusterReconcilerSpec) DeepCopy() *ClusterReconcilerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterReconcilerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Reconciler) DeepCopyInto(out *Reconciler) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Reconciler.
+func (in *Reconciler) DeepCopy() *Reconciler {
+	if in == nil {
+		return nil
+	}
+	out := new(Reconciler)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Reconciler) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReconcilerApprovalSpec) DeepCopyInto(out *ReconcilerApprovalSpec) {
+	*out = *in
+	if in.Kinds != nil {
+		in, out := &in.Kinds, &out.Kinds
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReconcilerApprovalSpec.
+func (in *ReconcilerApprovalSpec) DeepCopy() *ReconcilerApprovalSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReconcilerApprovalSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReconcilerDefinitionSpec) DeepCopyInto(out *ReconcilerDefinitionSpec) {
+	*out = *in
+	if in.ShortNames != nil {
+		in, out := &in.ShortNames, &out.ShortNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Schema != nil {
+		in, out := &in.Schema, &out.Schema
+		*out = (*in).DeepCopy()
+	}
+	if in.PrinterColumns != nil {
+		in, out := &in.PrinterColumns, &out.PrinterColumns
+		*out = make([]apiextensionsv1.CustomResourceColumnDefinition, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReconcilerDefinitionSpec.
+func (in *ReconcilerDefinitionSpec) DeepCopy() *ReconcilerDefinitionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReconcilerDefinitionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReconcilerForSpec) DeepCopyInto(out *ReconcilerForSpec) {
+	*out = *in
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Definition != nil {
+		in, out := &in.Definition, &out.Definition
+		*out = new(ReconcilerDefinitionSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReconcilerForSpec.
+func (in *ReconcilerForSpec) DeepCopy() *ReconcilerForSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReconcilerForSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReconcilerKindSpec) DeepCopyInto(out *ReconcilerKindSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReconcilerKindSpec.
+func (in *ReconcilerKindSpec) DeepCopy() *ReconcilerKindSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReconcilerKindSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReconcilerList) DeepCopyInto(out *ReconcilerList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Reconciler, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReconcilerList.
+func (in *ReconcilerList) DeepCopy() *ReconcilerList {
+	if in == nil {
+		return nil
+	}
+	out := new(ReconcilerList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ReconcilerList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReconcilerPendingChange) DeepCopyInto(out *ReconcilerPendingChange) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReconcilerPendingChange.
+func (in *ReconcilerPendingChange) DeepCopy() *ReconcilerPendingChange {
+	if in == nil {
+		return nil
+	}
+	out := new(ReconcilerPendingChange)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReconcilerRBACSpec) DeepCopyInto(out *ReconcilerRBACSpec) {
+	*out = *in
+	if in.Outputs != nil {
+		in, out := &in.Outputs, &out.Outputs
+		*out = make([]ReconcilerKindSpec, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReconcilerRBACSpec.
+func (in *ReconcilerRBACSpec) DeepCopy() *ReconcilerRBACSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReconcilerRBACSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReconcilerRateLimitSpec) DeepCopyInto(out *ReconcilerRateLimitSpec) {
+	*out = *in
+	if in.BaseDelay != nil {
+		in, out := &in.BaseDelay, &out.BaseDelay
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.MaxDelay != nil {
+		in, out := &in.MaxDelay, &out.MaxDelay
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReconcilerRateLimitSpec.
+func (in *ReconcilerRateLimitSpec) DeepCopy() *ReconcilerRateLimitSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReconcilerRateLimitSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReconcilerSafetySpec) DeepCopyInto(out *ReconcilerSafetySpec) {
+	*out = *in
+	if in.MaxDeletePercent != nil {
+		in, out := &in.MaxDeletePercent, &out.MaxDeletePercent
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxDeleteCount != nil {
+		in, out := &in.MaxDeleteCount, &out.MaxDeleteCount
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReconcilerSafetySpec.
+func (in *ReconcilerSafetySpec) DeepCopy() *ReconcilerSafetySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReconcilerSafetySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReconcilerScriptSpec) DeepCopyInto(out *ReconcilerScriptSpec) {
+	*out = *in
+	if in.Mode != nil {
+		in, out := &in.Mode, &out.Mode
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReconcilerScriptSpec.
+func (in *ReconcilerScriptSpec) DeepCopy() *ReconcilerScriptSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReconcilerScriptSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReconcilerSpec) DeepCopyInto(out *ReconcilerSpec) {
+	*out = *in
+	if in.For != nil {
+		in, out := &in.For, &out.For
+		*out = make([]ReconcilerForSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Scripts != nil {
+		in, out := &in.Scripts, &out.Scripts
+		*out = make([]ReconcilerScriptSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RateLimit != nil {
+		in, out := &in.RateLimit, &out.RateLimit
+		*out = new(ReconcilerRateLimitSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Timeouts != nil {
+		in, out := &in.Timeouts, &out.Timeouts
+		*out = new(ReconcilerTimeoutsSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DeletionDeadline != nil {
+		in, out := &in.DeletionDeadline, &out.DeletionDeadline
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Safety != nil {
+		in, out := &in.Safety, &out.Safety
+		*out = new(ReconcilerSafetySpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SensitiveFields != nil {
+		in, out := &in.SensitiveFields, &out.SensitiveFields
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RBAC != nil {
+		in, out := &in.RBAC, &out.RBAC
+		*out = new(ReconcilerRBACSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Approval != nil {
+		in, out := &in.Approval, &out.Approval
+		*out = new(ReconcilerApprovalSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReconcilerSpec.
+func (in *ReconcilerSpec) DeepCopy() *ReconcilerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReconcilerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReconcilerStatus) DeepCopyInto(out *ReconcilerStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PendingKinds != nil {
+		in, out := &in.PendingKinds, &out.PendingKinds
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PendingChanges != nil {
+		in, out := &in.PendingChanges, &out.PendingChanges
+		*out = make([]ReconcilerPendingChange, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReconcilerStatus.
+func (in *ReconcilerStatus) DeepCopy() *ReconcilerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ReconcilerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReconcilerTimeoutsSpec) DeepCopyInto(out *ReconcilerTimeoutsSpec) {
+	*out = *in
+	if in.Render != nil {
+		in, out := &in.Render, &out.Render
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Plan != nil {
+		in, out := &in.Plan, &out.Plan
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Deploy != nil {
+		in, out := &in.Deploy, &out.Deploy
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Delete != nil {
+		in, out := &in.Delete, &out.Delete
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.KappWait != nil {
+		in, out := &in.KappWait, &out.KappWait
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReconcilerTimeoutsSpec.
+func (in *ReconcilerTimeoutsSpec) DeepCopy() *ReconcilerTimeoutsSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReconcilerTimeoutsSpec)
+	in.DeepCopyInto(out)
+	return out
+}
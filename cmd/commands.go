@@ -0,0 +1,27 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+// commands are subcommands that are run instead of the operator (eg. to
+// work on scripts locally).
+var commands = map[string]func(args []string) error{
+	"render": runRender,
+	"pack":   runPack,
+	"unpack": runUnpack,
+	"test":   runTest,
+	"diff":   runDiff,
+}
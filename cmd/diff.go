@@ -0,0 +1,200 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	"github.com/dpeckett/ytt-operator/internal/controller"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// diffSummary is the machine readable output of the diff command.
+type diffSummary struct {
+	Objects   []controller.ObjectDiff `json:"objects"`
+	Changed   int                     `json:"changed"`
+	Unchanged int                     `json:"unchanged"`
+	Skipped   int                     `json:"skipped"`
+	Failed    int                     `json:"failed"`
+}
+
+// runDiff shows what reconciling every existing object with a candidate
+// reconcilers scripts would change in the cluster.
+func runDiff(args []string) error {
+	var reconcilerPath, namespace, output string
+	var failOnChanges bool
+	var opts controller.DiffOptions
+
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.StringVar(&reconcilerPath, "reconciler", "", "Path to the candidate Reconciler (or ClusterReconciler) YAML file.")
+	fs.StringVar(&namespace, "namespace", "", "The namespace of the reconciler, if not set in the file.")
+	fs.StringVar(&output, "output", "text", "Output format, either text or json.")
+	fs.BoolVar(&failOnChanges, "fail-on-changes", false, "Exit with an error if any object would change.")
+	fs.StringVar(&opts.YTTPath, "ytt", "ytt", "Path to the ytt binary.")
+	fs.StringVar(&opts.KappPath, "kapp", "kapp", "Path to the kapp binary.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s diff --reconciler FILE [--output text|json] [--fail-on-changes]\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if reconcilerPath == "" {
+		return errors.New("--reconciler is required")
+	}
+
+	if output != "text" && output != "json" {
+		return fmt.Errorf("unknown output format %q", output)
+	}
+
+	obj, spec, err := readReconciler(reconcilerPath)
+	if err != nil {
+		return err
+	}
+
+	// Kapp keeps the state of each app in the childs namespace.
+	switch obj := obj.(type) {
+	case *v1beta1.ClusterReconciler:
+		opts.AppNamespace = obj.Spec.Namespace
+		opts.QualifiedAppNames = true
+	default:
+		opts.AppNamespace = obj.GetNamespace()
+		if opts.AppNamespace == "" {
+			opts.AppNamespace = namespace
+		}
+	}
+
+	if opts.AppNamespace == "" {
+		return errors.New("the reconciler has no namespace, set --namespace")
+	}
+
+	// As in the child, a Reconciler with generated RBAC only sees its own namespace.
+	if reconciler, ok := obj.(*v1beta1.Reconciler); ok {
+		reconciler.Namespace = opts.AppNamespace
+		spec.Namespaces = reconciler.GetWatchedNamespaces()
+	}
+
+	scriptsDir, _, cleanup, err := loadScripts(reconcilerPath, "")
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	restConfig, err := ctrl.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+
+	diffs, err := controller.NewDiffer(c, spec, scriptsDir, opts).Diff(context.Background())
+	if err != nil {
+		return err
+	}
+
+	summary := summarizeDiffs(diffs)
+
+	if output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(summary); err != nil {
+			return err
+		}
+	} else {
+		writeDiffs(os.Stdout, summary)
+	}
+
+	if summary.Failed > 0 {
+		return fmt.Errorf("%d objects failed to diff", summary.Failed)
+	}
+
+	if failOnChanges && summary.Changed > 0 {
+		return fmt.Errorf("%d objects would change", summary.Changed)
+	}
+
+	return nil
+}
+
+func summarizeDiffs(diffs []controller.ObjectDiff) *diffSummary {
+	summary := &diffSummary{Objects: diffs}
+	if summary.Objects == nil {
+		summary.Objects = []controller.ObjectDiff{}
+	}
+
+	for _, diff := range diffs {
+		switch {
+		case diff.Error != "":
+			summary.Failed++
+		case diff.Skipped != "":
+			summary.Skipped++
+		case len(diff.Changes) > 0:
+			summary.Changed++
+		default:
+			summary.Unchanged++
+		}
+	}
+
+	return summary
+}
+
+// writeDiffs writes a human readable description of each objects changes.
+func writeDiffs(w io.Writer, summary *diffSummary) {
+	for _, diff := range summary.Objects {
+		name := diff.Name
+		if diff.Namespace != "" {
+			name = diff.Namespace + "/" + name
+		}
+
+		fmt.Fprintf(w, "%s %s (app %s): ", diff.Kind, name, diff.App)
+
+		switch {
+		case diff.Error != "":
+			fmt.Fprintf(w, "failed: %s\n", diff.Error)
+		case diff.Skipped != "":
+			fmt.Fprintf(w, "skipped: %s\n", diff.Skipped)
+		case len(diff.Changes) == 0:
+			fmt.Fprintln(w, "no changes")
+		default:
+			var changes []string
+			for _, c := range diff.Changes {
+				changes = append(changes, c.Op+" "+c.String())
+			}
+			fmt.Fprintf(w, "%s\n", strings.Join(changes, ", "))
+
+			if diff.Diff != "" {
+				fmt.Fprintf(w, "    %s\n", strings.ReplaceAll(diff.Diff, "\n", "\n    "))
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d changed, %d unchanged, %d skipped, %d failed\n",
+		summary.Changed, summary.Unchanged, summary.Skipped, summary.Failed)
+}
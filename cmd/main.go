@@ -18,10 +18,10 @@ package main
 
 import (
 	"context"
-	"encoding/base64"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
-	"path/filepath"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -29,17 +29,25 @@ import (
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
-	"github.com/dpeckett/ytt-operator/api/v1alpha1"
 	yttoperatorv1alpha1 "github.com/dpeckett/ytt-operator/api/v1alpha1"
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	yttoperatorv1beta1 "github.com/dpeckett/ytt-operator/api/v1beta1"
 	"github.com/dpeckett/ytt-operator/internal/controller"
+	"github.com/dpeckett/ytt-operator/internal/util"
+	"github.com/dpeckett/ytt-operator/internal/webhook"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -52,14 +60,32 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(yttoperatorv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(yttoperatorv1beta1.AddToScheme(scheme))
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := commands[os.Args[1]]; ok {
+			if err := run(os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			return
+		}
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
 	var reconcilerName string
+	var clusterReconcilerName string
+	var localScriptsDir string
+	var localKinds kindsFlag
+	var maxConcurrentProcesses int
+	var processMemoryThreshold float64
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
@@ -68,6 +94,16 @@ func main() {
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&reconcilerName, "reconciler-name", "",
 		"The name of the reconciler configuration to use, expected to be present in the same namespace as the operator.")
+	flag.StringVar(&clusterReconcilerName, "cluster-reconciler-name", "",
+		"The name of the cluster reconciler configuration to use.")
+	flag.StringVar(&localScriptsDir, "scripts-dir", "",
+		"Development mode: reconcile the --for kinds using the scripts in a local directory, instead of a reconciler configuration.")
+	flag.Var(&localKinds, "for",
+		"Development mode: a kind to reconcile as apiVersion/Kind (eg. example.com/v1/Database), may be repeated.")
+	flag.IntVar(&maxConcurrentProcesses, "max-concurrent-processes", 4,
+		"The maximum number of ytt and kapp processes that may run at once.")
+	flag.Float64Var(&processMemoryThreshold, "process-memory-threshold", 0.8,
+		"Delay starting new ytt and kapp processes while memory usage is above this fraction of the container limit (0 to disable).")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -76,8 +112,99 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	ctx := context.Background()
+	ctrl.LoggerInto(ctx, setupLog)
+
+	restConfig := ctrl.GetConfigOrDie()
+
+	if localScriptsDir != "" && (reconcilerName != "" || clusterReconcilerName != "" || len(localKinds) == 0) {
+		setupLog.Error(nil, "--scripts-dir needs at least one --for kind, and can't be used with a reconciler configuration")
+		os.Exit(1)
+	}
+
+	// Either a *v1beta1.Reconciler or a *v1beta1.ClusterReconciler.
+	var reconcilerConfig client.Object
+	var reconcilerSpec *v1beta1.ReconcilerSpec
+	var newCache cache.NewCacheFunc
+	if localScriptsDir != "" {
+		// Development mode, there is no reconciler configuration to fetch.
+		reconcilerSpec = &v1beta1.ReconcilerSpec{For: localKinds}
+	} else if reconcilerName != "" || clusterReconcilerName != "" {
+		ownNamespace := os.Getenv("POD_NAMESPACE")
+
+		// We only need to watch our own reconciler configuration.
+		var selectors cache.SelectorsByObject
+		if clusterReconcilerName != "" {
+			clusterReconciler := &v1beta1.ClusterReconciler{}
+			clusterReconciler.Name = clusterReconcilerName
+			reconcilerConfig, reconcilerSpec = clusterReconciler, &clusterReconciler.Spec.ReconcilerSpec
+
+			selectors = cache.SelectorsByObject{
+				&v1beta1.ClusterReconciler{}: {
+					Field: fields.SelectorFromSet(fields.Set{
+						"metadata.name": clusterReconcilerName,
+					}),
+				},
+			}
+		} else {
+			reconciler := &v1beta1.Reconciler{}
+			reconciler.Name = reconcilerName
+			reconciler.Namespace = ownNamespace
+			reconcilerConfig, reconcilerSpec = reconciler, &reconciler.Spec
+
+			selectors = cache.SelectorsByObject{
+				&v1beta1.Reconciler{}: {
+					Field: fields.SelectorFromSet(fields.Set{
+						"metadata.name":      reconcilerName,
+						"metadata.namespace": ownNamespace,
+					}),
+				},
+			}
+		}
+
+		// The manager isn't running yet, so use an uncached client.
+		c, err := client.New(restConfig, client.Options{Scheme: scheme})
+		if err != nil {
+			setupLog.Error(err, "Unable to create client")
+			os.Exit(1)
+		}
+
+		if err := c.Get(ctx, client.ObjectKeyFromObject(reconcilerConfig), reconcilerConfig); err != nil {
+			setupLog.Error(err, "Unable to retrieve reconciler configuration")
+			os.Exit(1)
+		}
+
+		// A Reconciler with generated RBAC only has access to its own
+		// namespace, unless it lists others.
+		if reconciler, ok := reconcilerConfig.(*v1beta1.Reconciler); ok {
+			reconciler.Spec.Namespaces = reconciler.GetWatchedNamespaces()
+		}
+
+		cacheOpts := cache.Options{
+			SelectorsByObject: selectors,
+		}
+
+		newCache = cache.BuilderWithOptions(cacheOpts)
+
+		// Only cache objects in the namespaces we are interested in (and our own).
+		if len(reconcilerSpec.Namespaces) > 0 {
+			namespaces := []string{ownNamespace}
+			for _, ns := range reconcilerSpec.Namespaces {
+				if ns != ownNamespace {
+					namespaces = append(namespaces, ns)
+				}
+			}
+
+			newCache = func(config *rest.Config, opts cache.Options) (cache.Cache, error) {
+				opts.SelectorsByObject = cacheOpts.SelectorsByObject
+				return cache.MultiNamespacedCacheBuilder(namespaces)(config, opts)
+			}
+		}
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme:                 scheme,
+		NewCache:               newCache,
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
 		HealthProbeBindAddress: probeAddr,
@@ -100,48 +227,66 @@ func main() {
 		os.Exit(1)
 	}
 
-	ctx := context.Background()
-	ctrl.LoggerInto(ctx, setupLog)
+	if reconcilerSpec != nil {
+		var drain *controller.Drain
+		var scriptsWatcher *controller.ScriptsWatcher
+		scriptsDir := localScriptsDir
+		if scriptsDir != "" {
+			// Reconcile everything again whenever a script is changed.
+			scriptsWatcher = controller.NewScriptsWatcher(scriptsDir)
+			if err := mgr.Add(scriptsWatcher); err != nil {
+				setupLog.Error(err, "Unable to watch scripts directory")
+				os.Exit(1)
+			}
+		} else {
+			scriptsDir, err = os.MkdirTemp("", "ytt-operator")
+			if err != nil {
+				setupLog.Error(err, "Unable to create temporary scripts directory")
+				os.Exit(1)
+			}
+			defer os.RemoveAll(scriptsDir)
 
-	if reconcilerName != "" {
-		var reconcilerConfig v1alpha1.Reconciler
-		err := mgr.GetAPIReader().Get(ctx, types.NamespacedName{
-			Name:      reconcilerName,
-			Namespace: os.Getenv("POD_NAMESPACE"),
-		}, &reconcilerConfig)
-		if err != nil {
-			setupLog.Error(err, "Unable to retrieve reconciler configuration")
-			os.Exit(1)
+			// Write the scripts out to a temporary directory.
+			if err := util.WriteScripts(scriptsDir, reconcilerSpec.Scripts); err != nil {
+				setupLog.Error(err, "Unable to write scripts to temporary directory")
+				os.Exit(1)
+			}
+
+			// Release all managed objects when the reconciler is deleted.
+			drain = controller.NewDrain(reconcilerConfig)
 		}
 
-		scriptsDir, err := os.MkdirTemp("", "ytt-operator")
-		if err != nil {
-			setupLog.Error(err, "Unable to create temporary scripts directory")
-			os.Exit(1)
+		pool := util.NewProcessPool(maxConcurrentProcesses, processMemoryThreshold)
+
+		// Pending changes found in the Observe mode are reported in the reconcilers status.
+		var changes *controller.ChangeReporter
+		if reconcilerConfig != nil {
+			changes = controller.NewChangeReporter(mgr.GetClient(), reconcilerConfig)
 		}
-		defer os.RemoveAll(scriptsDir)
 
-		// Write the scripts out to a temporary directory.
-		for _, s := range reconcilerConfig.Spec.Scripts {
-			data, err := base64.StdEncoding.DecodeString(s.Encoded)
+		var reconcilers []*controller.YTTReconciler
+		for _, gvk := range reconcilerSpec.For {
+			r, err := controller.NewYTTReconciler(mgr, gvk.GroupVersionKind(), scriptsDir, reconcilerSpec, pool, drain, scriptsWatcher, changes, clusterReconcilerName != "")
 			if err != nil {
-				setupLog.Error(err, "Unable to decode script")
+				setupLog.Error(err, "unable to create controller", "controller", gvk.Kind)
 				os.Exit(1)
 			}
 
-			if err := os.WriteFile(filepath.Join(scriptsDir, s.Name), data, 0o644); err != nil {
-				setupLog.Error(err, "Unable to write script to temporary directory")
-				os.Exit(1)
-			}
+			reconcilers = append(reconcilers, r)
 		}
 
-		for _, gvk := range reconcilerConfig.Spec.For {
-			// Register the reconciler for each GVK.
-			if err := controller.NewYTTReconciler(mgr, gvk.GroupVersionKind(), scriptsDir).SetupWithManager(mgr); err != nil {
-				setupLog.Error(err, "unable to create controller", "controller", gvk.GroupVersionKind().String())
+		if drain != nil {
+			if err := controller.NewDrainReconciler(mgr, reconcilerConfig, drain, reconcilers).SetupWithManager(mgr); err != nil {
+				setupLog.Error(err, "unable to create controller", "controller", "Drain")
 				os.Exit(1)
 			}
 		}
+
+		// Each reconciler is started once its kind is installed.
+		if err := controller.NewKindWatcher(mgr, reconcilerConfig, reconcilers, newCache).SetupWithManager(ctx, mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "KindWatcher")
+			os.Exit(1)
+		}
 	} else {
 		// Will be used as a template for the child reconcilers.
 		var parent corev1.Pod
@@ -159,6 +304,24 @@ func main() {
 			setupLog.Error(err, "unable to create controller", "controller", "Reconciler")
 			os.Exit(1)
 		}
+
+		if err := controller.NewClusterReconcilerReconciler(mgr, &parent).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "ClusterReconciler")
+			os.Exit(1)
+		}
+
+		if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+			if err := webhook.NewReconcilerValidator(mgr).SetupWithManager(mgr); err != nil {
+				setupLog.Error(err, "unable to create webhook", "webhook", "Reconciler")
+				os.Exit(1)
+			}
+
+			// Reading reconcilers stored in older versions relies on the conversion webhook.
+			if err := controller.NewStorageVersionMigrator(mgr).SetupWithManager(mgr); err != nil {
+				setupLog.Error(err, "unable to create storage version migrator")
+				os.Exit(1)
+			}
+		}
 	}
 
 	//+kubebuilder:scaffold:builder
@@ -0,0 +1,249 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	"github.com/dpeckett/ytt-operator/internal/util"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// packOptions are the options of the pack command.
+type packOptions struct {
+	dir                string
+	configPath         string
+	name               string
+	namespace          string
+	cluster            bool
+	kinds              kindsFlag
+	serviceAccountName string
+}
+
+// runPack builds a ready to apply Reconciler from a directory of scripts.
+func runPack(args []string) error {
+	var opts packOptions
+	var outputPath string
+
+	fs := flag.NewFlagSet("pack", flag.ContinueOnError)
+	fs.StringVar(&opts.dir, "dir", "", "Path to the directory of ytt scripts to pack.")
+	fs.StringVar(&opts.configPath, "config", "", "Path to a Reconciler (or ClusterReconciler) YAML file to start from, its scripts are replaced.")
+	fs.StringVar(&opts.name, "name", "", "The name of the reconciler.")
+	fs.StringVar(&opts.namespace, "namespace", "", "The namespace of the reconciler (or for a ClusterReconciler, the namespace its child runs in).")
+	fs.BoolVar(&opts.cluster, "cluster", false, "Build a ClusterReconciler (when not starting from a config file).")
+	fs.Var(&opts.kinds, "for", "A kind to reconcile as apiVersion/Kind (eg. example.com/v1/Database), may be repeated. Replaces the kinds of the config file.")
+	fs.StringVar(&opts.serviceAccountName, "service-account", "", "The service account the reconciler runs as.")
+	fs.StringVar(&outputPath, "output", "", "Path to write the reconciler to (default stdout).")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s pack --dir DIR [--config FILE] [--name NAME] [--for apiVersion/Kind]...\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	obj, err := pack(opts)
+	if err != nil {
+		return err
+	}
+
+	return writeReconciler(outputPath, obj)
+}
+
+func pack(opts packOptions) (client.Object, error) {
+	if opts.dir == "" {
+		return nil, errors.New("--dir is required")
+	}
+
+	var obj client.Object
+	var spec *v1beta1.ReconcilerSpec
+	if opts.configPath != "" {
+		var err error
+		obj, spec, err = readReconciler(opts.configPath)
+		if err != nil {
+			return nil, err
+		}
+	} else if opts.cluster {
+		clusterReconciler := &v1beta1.ClusterReconciler{}
+		clusterReconciler.SetGroupVersionKind(v1beta1.GroupVersion.WithKind("ClusterReconciler"))
+		obj, spec = clusterReconciler, &clusterReconciler.Spec.ReconcilerSpec
+	} else {
+		reconciler := &v1beta1.Reconciler{}
+		reconciler.SetGroupVersionKind(v1beta1.GroupVersion.WithKind("Reconciler"))
+		obj, spec = reconciler, &reconciler.Spec
+	}
+
+	if opts.name != "" {
+		obj.SetName(opts.name)
+	}
+
+	if obj.GetName() == "" {
+		return nil, errors.New("the reconciler needs a name, set --name")
+	}
+
+	if opts.namespace != "" {
+		if clusterReconciler, ok := obj.(*v1beta1.ClusterReconciler); ok {
+			clusterReconciler.Spec.Namespace = opts.namespace
+		} else {
+			obj.SetNamespace(opts.namespace)
+		}
+	}
+
+	if len(opts.kinds) > 0 {
+		spec.For = opts.kinds
+	}
+
+	if len(spec.For) == 0 {
+		return nil, errors.New("the reconciler needs at least one kind, set --for")
+	}
+
+	if opts.serviceAccountName != "" {
+		spec.ServiceAccountName = opts.serviceAccountName
+	}
+
+	scripts, err := util.ReadScripts(opts.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scripts: %w", err)
+	}
+
+	if len(scripts) == 0 {
+		return nil, fmt.Errorf("no scripts found in %s", opts.dir)
+	}
+
+	if err := util.ValidateScripts(scripts); err != nil {
+		return nil, err
+	}
+
+	spec.Scripts = scripts
+
+	return obj, nil
+}
+
+// runUnpack writes the scripts of a reconciler out to a directory, so they
+// can be edited and packed again.
+func runUnpack(args []string) error {
+	var reconcilerPath, dir, configPath string
+
+	fs := flag.NewFlagSet("unpack", flag.ContinueOnError)
+	fs.StringVar(&reconcilerPath, "reconciler", "", "Path to the Reconciler (or ClusterReconciler) YAML file to unpack.")
+	fs.StringVar(&dir, "dir", "", "Path to the directory to write the scripts to, existing files are never overwritten.")
+	fs.StringVar(&configPath, "config", "", "Path to write the rest of the reconciler to (without its scripts), for use with pack --config.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s unpack --reconciler FILE --dir DIR [--config FILE]\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if reconcilerPath == "" || dir == "" {
+		return errors.New("--reconciler and --dir are required")
+	}
+
+	obj, spec, err := readReconciler(reconcilerPath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create scripts directory: %w", err)
+	}
+
+	if err := util.WriteScripts(dir, spec.Scripts); err != nil {
+		return err
+	}
+
+	if configPath == "" {
+		return nil
+	}
+
+	spec.Scripts = nil
+
+	return writeReconciler(configPath, obj)
+}
+
+// writeReconciler writes a reconciler as YAML to a file (or stdout if path
+// is empty), leaving out its status and any server populated fields.
+func writeReconciler(path string, obj client.Object) error {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return fmt.Errorf("failed to convert reconciler: %w", err)
+	}
+
+	unstructured.RemoveNestedField(content, "status")
+	for _, field := range []string{"creationTimestamp", "resourceVersion", "uid", "generation", "managedFields"} {
+		unstructured.RemoveNestedField(content, "metadata", field)
+	}
+
+	data, err := util.JoinManifests([]map[string]interface{}{content})
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", path, err)
+		}
+		defer f.Close()
+
+		w = f
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// kindsFlag is a repeatable flag of kinds, given as apiVersion/Kind.
+type kindsFlag []v1beta1.ReconcilerForSpec
+
+func (f *kindsFlag) String() string {
+	var kinds []string
+	for _, t := range *f {
+		kinds = append(kinds, t.APIVersion+"/"+t.Kind)
+	}
+
+	return strings.Join(kinds, ",")
+}
+
+func (f *kindsFlag) Set(value string) error {
+	i := strings.LastIndex(value, "/")
+	if i <= 0 || i == len(value)-1 {
+		return fmt.Errorf("invalid kind %q: expected apiVersion/Kind", value)
+	}
+
+	apiVersion, kind := value[:i], value[i+1:]
+	if _, err := schema.ParseGroupVersion(apiVersion); err != nil {
+		return fmt.Errorf("invalid kind %q: %w", value, err)
+	}
+
+	*f = append(*f, v1beta1.ReconcilerForSpec{APIVersion: apiVersion, Kind: kind})
+
+	return nil
+}
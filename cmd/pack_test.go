@@ -0,0 +1,94 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPack(t *testing.T) {
+	dir := t.TempDir()
+
+	scriptsDir := filepath.Join(dir, "scripts")
+	require.NoError(t, os.MkdirAll(filepath.Join(scriptsDir, "lib"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(scriptsDir, "config.yaml"), []byte("#@ load(\"lib/helpers.star\", \"name\")\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(scriptsDir, "lib", "helpers.star"), []byte("def name(): return \"x\"\nend\n"), 0o644))
+
+	var kinds kindsFlag
+	require.NoError(t, kinds.Set("example.com/v1/Database"))
+	require.NoError(t, kinds.Set("v1/ConfigMap"))
+	assert.Error(t, kinds.Set("Database"))
+
+	obj, err := pack(packOptions{
+		dir:                scriptsDir,
+		name:               "databases",
+		namespace:          "operators",
+		kinds:              kinds,
+		serviceAccountName: "databases",
+	})
+	require.NoError(t, err)
+
+	reconcilerPath := filepath.Join(dir, "reconciler.yaml")
+	require.NoError(t, writeReconciler(reconcilerPath, obj))
+
+	packed, spec, err := readReconciler(reconcilerPath)
+	require.NoError(t, err)
+	assert.Equal(t, "operators", packed.GetNamespace())
+	assert.Equal(t, "databases", spec.ServiceAccountName)
+	assert.Equal(t, []v1beta1.ReconcilerForSpec{
+		{APIVersion: "example.com/v1", Kind: "Database"},
+		{APIVersion: "v1", Kind: "ConfigMap"},
+	}, spec.For)
+	assert.Equal(t, []v1beta1.ReconcilerScriptSpec{
+		{Name: "config.yaml", Content: "#@ load(\"lib/helpers.star\", \"name\")\n"},
+		{Name: "lib/helpers.star", Content: "def name(): return \"x\"\nend\n"},
+	}, spec.Scripts)
+
+	t.Run("Unpack", func(t *testing.T) {
+		unpackedDir := filepath.Join(dir, "unpacked")
+		configPath := filepath.Join(dir, "config.yaml")
+		require.NoError(t, runUnpack([]string{"--reconciler", reconcilerPath, "--dir", unpackedDir, "--config", configPath}))
+
+		data, err := os.ReadFile(filepath.Join(unpackedDir, "lib", "helpers.star"))
+		require.NoError(t, err)
+		assert.Equal(t, "def name(): return \"x\"\nend\n", string(data))
+
+		_, config, err := readReconciler(configPath)
+		require.NoError(t, err)
+		assert.Empty(t, config.Scripts)
+
+		repacked, err := pack(packOptions{dir: unpackedDir, configPath: configPath})
+		require.NoError(t, err)
+		assert.Equal(t, obj, repacked, "Unpacking and packing again should give the same reconciler")
+	})
+
+	t.Run("ClusterReconciler", func(t *testing.T) {
+		obj, err := pack(packOptions{dir: scriptsDir, name: "databases", namespace: "operators", cluster: true, kinds: kinds})
+		require.NoError(t, err)
+
+		clusterReconciler, ok := obj.(*v1beta1.ClusterReconciler)
+		require.True(t, ok)
+		assert.Empty(t, clusterReconciler.Namespace)
+		assert.Equal(t, "operators", clusterReconciler.Spec.Namespace)
+	})
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/dpeckett/ytt-operator/api/v1alpha1"
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	"github.com/dpeckett/ytt-operator/internal/util"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// readReconciler reads a Reconciler (of any served version) or
+// ClusterReconciler from a YAML file. Reconcilers are converted to v1beta1.
+func readReconciler(path string) (client.Object, *v1beta1.ReconcilerSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read reconciler: %w", err)
+	}
+
+	obj, _, err := serializer.NewCodecFactory(scheme).UniversalDeserializer().Decode(data, nil, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode reconciler: %w", err)
+	}
+
+	switch obj := obj.(type) {
+	case *v1beta1.Reconciler:
+		return obj, &obj.Spec, nil
+	case *v1beta1.ClusterReconciler:
+		return obj, &obj.Spec.ReconcilerSpec, nil
+	case *v1alpha1.Reconciler:
+		var hub v1beta1.Reconciler
+		if err := obj.ConvertTo(&hub); err != nil {
+			return nil, nil, fmt.Errorf("failed to convert reconciler: %w", err)
+		}
+		hub.SetGroupVersionKind(v1beta1.GroupVersion.WithKind("Reconciler"))
+
+		return &hub, &hub.Spec, nil
+	default:
+		return nil, nil, fmt.Errorf("%s is not a reconciler", obj.GetObjectKind().GroupVersionKind().Kind)
+	}
+}
+
+// loadScripts returns the directory of scripts to render, either as given or
+// written out from a reconciler to a temporary directory. For reconcilers,
+// the kinds it is for are also returned. The caller must call cleanup.
+func loadScripts(reconcilerPath, scriptsDir string) (dir string, kinds []schema.GroupVersionKind, cleanup func(), err error) {
+	if (reconcilerPath == "") == (scriptsDir == "") {
+		return "", nil, nil, errors.New("exactly one of --reconciler or --scripts-dir is required")
+	}
+
+	if scriptsDir != "" {
+		return scriptsDir, nil, func() {}, nil
+	}
+
+	_, spec, err := readReconciler(reconcilerPath)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	for _, t := range spec.For {
+		kinds = append(kinds, t.GroupVersionKind())
+	}
+
+	dir, err = os.MkdirTemp("", "ytt-operator")
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to create temporary scripts directory: %w", err)
+	}
+
+	cleanup = func() {
+		_ = os.RemoveAll(dir)
+	}
+
+	if err := util.WriteScripts(dir, spec.Scripts); err != nil {
+		cleanup()
+		return "", nil, nil, err
+	}
+
+	return dir, kinds, cleanup, nil
+}
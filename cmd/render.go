@@ -0,0 +1,99 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dpeckett/ytt-operator/internal/controller"
+	"github.com/dpeckett/ytt-operator/internal/util"
+)
+
+// renderOptions are the options of the render command.
+type renderOptions struct {
+	reconcilerPath string
+	scriptsDir     string
+	objectPath     string
+	yttPath        string
+}
+
+// runRender renders the manifests for a sample object, exactly as a
+// reconciler would pass them to kapp, without needing a cluster.
+func runRender(args []string) error {
+	var opts renderOptions
+
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	fs.StringVar(&opts.reconcilerPath, "reconciler", "", "Path to a Reconciler (or ClusterReconciler) YAML file, whose scripts are rendered.")
+	fs.StringVar(&opts.scriptsDir, "scripts-dir", "", "Path to a directory of ytt scripts to render (instead of a reconciler).")
+	fs.StringVar(&opts.objectPath, "object", "", "Path to a YAML file containing the sample object.")
+	fs.StringVar(&opts.yttPath, "ytt", "ytt", "Path to the ytt binary.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s render (--reconciler FILE | --scripts-dir DIR) --object FILE\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	out, err := render(context.Background(), opts)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+func render(ctx context.Context, opts renderOptions) ([]byte, error) {
+	if opts.objectPath == "" {
+		return nil, errors.New("--object is required")
+	}
+
+	obj, err := util.ReadObject(opts.objectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	scriptsDir, kinds, cleanup, err := loadScripts(opts.reconcilerPath, opts.scriptsDir)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	if kinds != nil {
+		gvk := obj.GroupVersionKind()
+
+		reconciled := false
+		for _, kind := range kinds {
+			if kind == gvk {
+				reconciled = true
+				break
+			}
+		}
+
+		if !reconciled {
+			return nil, fmt.Errorf("reconciler is not for %s", gvk.String())
+		}
+	}
+
+	return controller.Render(ctx, opts.yttPath, scriptsDir, obj)
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	dir := t.TempDir()
+
+	// A stand in for ytt that echoes back the data values it was given.
+	yttPath := filepath.Join(dir, "ytt")
+	require.NoError(t, os.WriteFile(yttPath, []byte("#!/bin/sh\ncat\n"), 0o755))
+
+	reconcilerPath := filepath.Join(dir, "reconciler.yaml")
+	require.NoError(t, os.WriteFile(reconcilerPath, []byte(`apiVersion: ytt-operator.pecke.tt/v1beta1
+kind: Reconciler
+metadata:
+  name: databases
+spec:
+  for:
+  - apiVersion: example.com/v1
+    kind: Database
+  scripts:
+  - name: config.yaml
+    content: ""
+`), 0o644))
+
+	objectPath := filepath.Join(dir, "object.yaml")
+	require.NoError(t, os.WriteFile(objectPath, []byte(`apiVersion: example.com/v1
+kind: Database
+metadata:
+  name: my-db
+spec:
+  replicas: 3
+`), 0o644))
+
+	ctx := context.Background()
+
+	out, err := render(ctx, renderOptions{reconcilerPath: reconcilerPath, objectPath: objectPath, yttPath: yttPath})
+	require.NoError(t, err)
+
+	assert.Equal(t, `#@data/values
+---
+apiVersion: example.com/v1
+kind: Database
+metadata:
+    finalizers:
+        - ytt-operator.damian.pecke.tt
+    name: my-db
+spec:
+    replicas: 3
+`, string(out))
+
+	t.Run("Other kind", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(objectPath, []byte("apiVersion: example.com/v1\nkind: Cache\nmetadata:\n  name: my-cache\n"), 0o644))
+
+		_, err := render(ctx, renderOptions{reconcilerPath: reconcilerPath, objectPath: objectPath, yttPath: yttPath})
+		assert.Error(t, err)
+	})
+
+	t.Run("Scripts dir", func(t *testing.T) {
+		_, err := render(ctx, renderOptions{scriptsDir: dir, objectPath: objectPath, yttPath: yttPath})
+		assert.NoError(t, err)
+	})
+}
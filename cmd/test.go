@@ -0,0 +1,96 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dpeckett/ytt-operator/pkg/rendertest"
+)
+
+// runTest runs a reconcilers scripts against directories of sample objects,
+// comparing the output to the expected manifests (see pkg/rendertest).
+func runTest(args []string) error {
+	var reconcilerPath, scriptsDir, casesDir string
+	var opts rendertest.Options
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.StringVar(&reconcilerPath, "reconciler", "", "Path to a Reconciler (or ClusterReconciler) YAML file, whose scripts are tested.")
+	fs.StringVar(&scriptsDir, "scripts-dir", "", "Path to a directory of ytt scripts to test (instead of a reconciler).")
+	fs.StringVar(&casesDir, "cases", "", "Path to a directory of test cases, one per subdirectory.")
+	fs.BoolVar(&opts.Update, "update", false, "Write the rendered output of each case to its expected manifests.")
+	fs.StringVar(&opts.YTTPath, "ytt", "ytt", "Path to the ytt binary.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s test (--reconciler FILE | --scripts-dir DIR) --cases DIR [--update]\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if casesDir == "" {
+		return errors.New("--cases is required")
+	}
+
+	dir, kinds, cleanup, err := loadScripts(reconcilerPath, scriptsDir)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	opts.Kinds = kinds
+
+	results, err := rendertest.Run(context.Background(), dir, casesDir, opts)
+	if err != nil {
+		return err
+	}
+
+	return reportResults(os.Stdout, results)
+}
+
+// reportResults writes out the outcome of each case, returning an error if
+// any failed.
+func reportResults(w io.Writer, results []rendertest.Result) error {
+	failed := 0
+	for _, result := range results {
+		switch {
+		case !result.Passed():
+			failed++
+			fmt.Fprintf(w, "FAIL %s\n", result.Name)
+			for _, failure := range result.Failures {
+				fmt.Fprintf(w, "    %s\n", strings.ReplaceAll(failure, "\n", "\n    "))
+			}
+		case result.Updated:
+			fmt.Fprintf(w, "UPDATED %s\n", result.Name)
+		default:
+			fmt.Fprintf(w, "PASS %s\n", result.Name)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d cases failed", failed, len(results))
+	}
+
+	return nil
+}
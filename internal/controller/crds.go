@@ -0,0 +1,178 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// crdOwnerLabel is set on CRDs created for a reconciler, its value
+// identifies the reconciler that defined them.
+const crdOwnerLabel = "ytt-operator.pecke.tt/crd-owner"
+
+// crdEstablishPollInterval is how often we check if defined CRDs have been
+// established (before starting the child).
+const crdEstablishPollInterval = 2 * time.Second
+
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get;list;watch;create;update;patch
+
+// reconcileCRDs creates (or upgrades) the CRDs of the kinds a reconciler
+// defines. It returns false if any of them are yet to be established.
+//
+// CRDs are never deleted, as that would delete every object of the kind.
+func (r *ReconcilerReconciler) reconcileCRDs(ctx context.Context, obj reconcilerObject) (bool, error) {
+	logger := log.FromContext(ctx)
+
+	established := true
+	for _, t := range obj.GetReconcilerSpec().For {
+		if t.Definition == nil {
+			continue
+		}
+
+		gvk := t.GroupVersionKind()
+
+		crd := &apiextensionsv1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: t.Plural() + "." + gvk.Group},
+		}
+		result, err := controllerutil.CreateOrUpdate(ctx, r.Client, crd, func() error {
+			if crd.ResourceVersion != "" && crd.Labels[crdOwnerLabel] != ownerID(obj) {
+				return fmt.Errorf("crd %s already exists and is not managed by this reconciler", crd.Name)
+			}
+
+			if crd.Labels == nil {
+				crd.Labels = map[string]string{}
+			}
+			crd.Labels[crdOwnerLabel] = ownerID(obj)
+
+			updateCRD(crd, t)
+
+			return nil
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed to patch crd: %w", err)
+		}
+
+		if result != controllerutil.OperationResultNone {
+			logger.Info("Defined custom resource", "crd", crd.Name, "version", gvk.Version, "operation", result)
+		}
+
+		if !isEstablished(crd) {
+			established = false
+		}
+	}
+
+	return established, nil
+}
+
+// updateCRD updates a CRD to match the definition of a kind. Versions other
+// than the kinds are left in place, but are no longer stored.
+func updateCRD(crd *apiextensionsv1.CustomResourceDefinition, t v1beta1.ReconcilerForSpec) {
+	gvk := t.GroupVersionKind()
+	def := t.Definition
+
+	scope := def.Scope
+	if scope == "" {
+		scope = apiextensionsv1.NamespaceScoped
+	}
+
+	crd.Spec.Group = gvk.Group
+	crd.Spec.Scope = scope
+	crd.Spec.Names = apiextensionsv1.CustomResourceDefinitionNames{
+		Kind:       gvk.Kind,
+		ListKind:   gvk.Kind + "List",
+		Plural:     t.Plural(),
+		Singular:   strings.ToLower(gvk.Kind),
+		ShortNames: def.ShortNames,
+	}
+
+	version := apiextensionsv1.CustomResourceDefinitionVersion{
+		Name:    gvk.Version,
+		Served:  true,
+		Storage: true,
+		Schema: &apiextensionsv1.CustomResourceValidation{
+			OpenAPIV3Schema: crdSchema(def.Schema),
+		},
+		// The status subresource is needed to report conditions.
+		Subresources: &apiextensionsv1.CustomResourceSubresources{
+			Status: &apiextensionsv1.CustomResourceSubresourceStatus{},
+		},
+		AdditionalPrinterColumns: def.PrinterColumns,
+	}
+
+	found := false
+	for i := range crd.Spec.Versions {
+		if crd.Spec.Versions[i].Name == version.Name {
+			crd.Spec.Versions[i] = version
+			found = true
+		} else {
+			crd.Spec.Versions[i].Storage = false
+		}
+	}
+	if !found {
+		crd.Spec.Versions = append(crd.Spec.Versions, version)
+	}
+}
+
+// crdSchema returns the schema of a defined kind, objects without a schema
+// may have any fields. Either way, a status field is added if missing.
+func crdSchema(schema *apiextensionsv1.JSONSchemaProps) *apiextensionsv1.JSONSchemaProps {
+	preserveUnknownFields := true
+
+	if schema == nil {
+		return &apiextensionsv1.JSONSchemaProps{
+			Type:                   "object",
+			XPreserveUnknownFields: &preserveUnknownFields,
+		}
+	}
+
+	schema = schema.DeepCopy()
+	if schema.Type == "" {
+		schema.Type = "object"
+	}
+
+	if _, ok := schema.Properties["status"]; !ok && schema.XPreserveUnknownFields == nil {
+		if schema.Properties == nil {
+			schema.Properties = map[string]apiextensionsv1.JSONSchemaProps{}
+		}
+
+		schema.Properties["status"] = apiextensionsv1.JSONSchemaProps{
+			Type:                   "object",
+			XPreserveUnknownFields: &preserveUnknownFields,
+		}
+	}
+
+	return schema
+}
+
+func isEstablished(crd *apiextensionsv1.CustomResourceDefinition) bool {
+	for _, cond := range crd.Status.Conditions {
+		if cond.Type == apiextensionsv1.Established {
+			return cond.Status == apiextensionsv1.ConditionTrue
+		}
+	}
+
+	return false
+}
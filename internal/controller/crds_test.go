@@ -0,0 +1,106 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReconcileCRDs(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, apiextensionsv1.AddToScheme(scheme))
+
+	r := &ReconcilerReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(&apiextensionsv1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "caches.example.com"},
+		}).Build(),
+	}
+
+	obj := &v1beta1.Reconciler{
+		ObjectMeta: metav1.ObjectMeta{Name: "databases", Namespace: "default"},
+		Spec: v1beta1.ReconcilerSpec{
+			For: []v1beta1.ReconcilerForSpec{{
+				APIVersion: "example.com/v1",
+				Kind:       "Database",
+				Definition: &v1beta1.ReconcilerDefinitionSpec{
+					ShortNames: []string{"db"},
+					Schema: &apiextensionsv1.JSONSchemaProps{
+						Properties: map[string]apiextensionsv1.JSONSchemaProps{
+							"spec": {Type: "object"},
+						},
+					},
+					PrinterColumns: []apiextensionsv1.CustomResourceColumnDefinition{
+						{Name: "Engine", Type: "string", JSONPath: ".spec.engine"},
+					},
+				},
+			}},
+		},
+	}
+
+	ctx := context.Background()
+
+	established, err := r.reconcileCRDs(ctx, obj)
+	require.NoError(t, err)
+	assert.False(t, established, "New CRDs aren't established until the api server says so")
+
+	var crd apiextensionsv1.CustomResourceDefinition
+	require.NoError(t, r.Get(ctx, client.ObjectKey{Name: "databases.example.com"}, &crd))
+
+	assert.Equal(t, ownerID(obj), crd.Labels[crdOwnerLabel])
+	assert.Equal(t, apiextensionsv1.NamespaceScoped, crd.Spec.Scope)
+	assert.Equal(t, "DatabaseList", crd.Spec.Names.ListKind)
+	assert.Equal(t, []string{"db"}, crd.Spec.Names.ShortNames)
+
+	require.Len(t, crd.Spec.Versions, 1)
+	version := crd.Spec.Versions[0]
+	assert.True(t, version.Storage)
+	assert.NotNil(t, version.Subresources.Status)
+	assert.Len(t, version.AdditionalPrinterColumns, 1)
+	assert.Equal(t, "object", version.Schema.OpenAPIV3Schema.Type)
+	assert.Contains(t, version.Schema.OpenAPIV3Schema.Properties, "status", "A status field should be added")
+
+	t.Run("New version", func(t *testing.T) {
+		upgraded := obj.DeepCopy()
+		upgraded.Spec.For[0].APIVersion = "example.com/v2"
+
+		_, err := r.reconcileCRDs(ctx, upgraded)
+		require.NoError(t, err)
+
+		require.NoError(t, r.Get(ctx, client.ObjectKey{Name: "databases.example.com"}, &crd))
+		require.Len(t, crd.Spec.Versions, 2)
+		assert.False(t, crd.Spec.Versions[0].Storage, "Old versions should no longer be stored")
+		assert.True(t, crd.Spec.Versions[1].Storage)
+	})
+
+	t.Run("Unmanaged", func(t *testing.T) {
+		unmanaged := obj.DeepCopy()
+		unmanaged.Spec.For[0].Kind = "Cache"
+
+		_, err := r.reconcileCRDs(ctx, unmanaged)
+		assert.Error(t, err, "Existing CRDs that we didn't create should be left alone")
+	})
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDeletionBlocked(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	newObject := func(name string, deletedAgo time.Duration) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			Finalizers:        []string{finalizer},
+			DeletionTimestamp: &metav1.Time{Time: time.Now().Add(-deletedAgo)},
+		}}
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newObject("recent", time.Minute),
+		newObject("overdue", 2*time.Hour),
+	).Build()
+
+	r := &YTTReconciler{
+		Client:   c,
+		spec:     &v1beta1.ReconcilerSpec{DeletionDeadline: &metav1.Duration{Duration: time.Hour}},
+		recorder: record.NewFakeRecorder(10),
+	}
+
+	ctx := context.Background()
+	cause := fmt.Errorf("kapp delete failed")
+
+	get := func(name string) *unstructured.Unstructured {
+		var obj unstructured.Unstructured
+		obj.SetAPIVersion("v1")
+		obj.SetKind("ConfigMap")
+		require.NoError(t, c.Get(ctx, client.ObjectKey{Name: name, Namespace: "default"}, &obj))
+		return &obj
+	}
+
+	result, err := r.deletionBlocked(ctx, get("recent"), cause)
+	require.NoError(t, err, "Errors would be retried with a backoff that can overshoot the deadline")
+	assert.Equal(t, deletionRetryInterval, result.RequeueAfter)
+	assert.Contains(t, get("recent").GetFinalizers(), finalizer)
+
+	_, err = r.deletionBlocked(ctx, get("overdue"), cause)
+	require.NoError(t, err)
+
+	var overdue corev1.ConfigMap
+	err = c.Get(ctx, client.ObjectKey{Name: "overdue", Namespace: "default"}, &overdue)
+	assert.True(t, errors.IsNotFound(err), "The finalizer should be removed once the deadline has passed")
+
+	t.Run("No deadline", func(t *testing.T) {
+		r := &YTTReconciler{Client: c, spec: &v1beta1.ReconcilerSpec{}, recorder: record.NewFakeRecorder(10)}
+
+		_, err := r.deletionBlocked(ctx, get("recent"), cause)
+		assert.ErrorIs(t, err, cause)
+	})
+}
@@ -0,0 +1,237 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	"github.com/dpeckett/ytt-operator/internal/util"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DiffOptions configure a Differ.
+type DiffOptions struct {
+	// AppNamespace is the namespace kapp stores app state in, ie. the
+	// namespace of the reconcilers child.
+	AppNamespace string
+	// QualifiedAppNames is set for ClusterReconcilers (see YTTReconciler).
+	QualifiedAppNames bool
+	// YTTPath and KappPath are the paths to the binaries (default "ytt" and
+	// "kapp").
+	YTTPath  string
+	KappPath string
+}
+
+// ObjectDiff describes what reconciling an object would change.
+type ObjectDiff struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	// App is the kapp app of the object.
+	App string `json:"app"`
+	// Skipped is why the object wouldn't be reconciled, if it wouldn't be.
+	Skipped string `json:"skipped,omitempty"`
+	// Error is set if the object couldn't be rendered or diffed.
+	Error string `json:"error,omitempty"`
+	// Changes are the changes kapp would make.
+	Changes []util.KappChange `json:"changes,omitempty"`
+	// Diff is kapps description of the changes.
+	Diff string `json:"-"`
+}
+
+// Differ works out what reconciling every existing object with a reconcilers
+// scripts would change, without changing anything.
+type Differ struct {
+	client     client.Client
+	spec       *v1beta1.ReconcilerSpec
+	scriptsDir string
+	opts       DiffOptions
+}
+
+// NewDiffer creates a differ for the scripts in scriptsDir, which needn't be
+// the scripts the reconciler is currently running.
+func NewDiffer(c client.Client, spec *v1beta1.ReconcilerSpec, scriptsDir string, opts DiffOptions) *Differ {
+	if opts.YTTPath == "" {
+		opts.YTTPath = "ytt"
+	}
+
+	if opts.KappPath == "" {
+		opts.KappPath = "kapp"
+	}
+
+	return &Differ{
+		client:     c,
+		spec:       spec,
+		scriptsDir: scriptsDir,
+		opts:       opts,
+	}
+}
+
+// Diff returns a diff for every object of the reconcilers kinds. Failures to
+// diff individual objects are reported in their diff.
+func (d *Differ) Diff(ctx context.Context) ([]ObjectDiff, error) {
+	var diffs []ObjectDiff
+	for _, t := range d.spec.For {
+		r := &YTTReconciler{
+			Client:            d.client,
+			gvk:               t.GroupVersionKind(),
+			scriptsDir:        d.scriptsDir,
+			spec:              d.spec,
+			redactor:          util.NewRedactor(d.spec.SensitiveFields),
+			qualifiedAppNames: d.opts.QualifiedAppNames,
+		}
+
+		var err error
+		r.selector, err = newObjectSelector(d.spec, r.gvk)
+		if err != nil {
+			return nil, err
+		}
+
+		objs, err := d.list(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range objs {
+			diffs = append(diffs, d.diff(ctx, r, &objs[i]))
+		}
+	}
+
+	return diffs, nil
+}
+
+// list returns the objects of a kind in the reconcilers namespaces.
+func (d *Differ) list(ctx context.Context, r *YTTReconciler) ([]unstructured.Unstructured, error) {
+	namespaces := d.spec.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+
+	var objs []unstructured.Unstructured
+	for _, ns := range namespaces {
+		var list unstructured.UnstructuredList
+		list.SetGroupVersionKind(r.gvk.GroupVersion().WithKind(r.gvk.Kind + "List"))
+
+		if err := d.client.List(ctx, &list, client.InNamespace(ns)); err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", r.gvk.String(), err)
+		}
+
+		objs = append(objs, list.Items...)
+	}
+
+	sort.Slice(objs, func(i, j int) bool {
+		return objs[i].GetNamespace()+"/"+objs[i].GetName() < objs[j].GetNamespace()+"/"+objs[j].GetName()
+	})
+
+	return objs, nil
+}
+
+func (d *Differ) diff(ctx context.Context, r *YTTReconciler, obj *unstructured.Unstructured) ObjectDiff {
+	diff := ObjectDiff{
+		APIVersion: r.gvk.GroupVersion().String(),
+		Kind:       r.gvk.Kind,
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+		App:        r.appName(obj),
+	}
+
+	if message := r.pausedMessage(obj); message != "" {
+		diff.Skipped = message
+		return diff
+	}
+
+	if obj.GetDeletionTimestamp() != nil {
+		diff.Skipped = "Object is being deleted"
+		return diff
+	}
+
+	selected, err := r.selector.Matches(ctx, d.client, obj)
+	if err != nil {
+		diff.Error = fmt.Sprintf("failed to match object: %v", err)
+		return diff
+	} else if !selected {
+		diff.Skipped = "Object is not selected"
+		return diff
+	}
+
+	out, err := Render(ctx, d.opts.YTTPath, d.scriptsDir, obj)
+	if err != nil {
+		// Ytt errors can quote the data values, so mask anything sensitive in the object.
+		values, _ := util.DataValues(obj.Object)
+		_, redaction := r.redactor.Redact(values)
+		diff.Error = redaction.String(err.Error())
+		return diff
+	}
+
+	diff.Changes, diff.Diff, err = d.kappDiff(ctx, r, obj, out)
+	if err != nil {
+		diff.Error = err.Error()
+	}
+
+	return diff
+}
+
+// kappDiff asks kapp which changes it would make to deploy a render, and for
+// a description of them.
+func (d *Differ) kappDiff(ctx context.Context, r *YTTReconciler, obj *unstructured.Unstructured, out []byte) ([]util.KappChange, string, error) {
+	args := []string{"deploy", "-a", r.appName(obj), "-f", "-", "--diff-run", "--diff-changes", "--json"}
+	if d.opts.AppNamespace != "" {
+		args = append(args, "-n", d.opts.AppNamespace)
+	}
+
+	docs, err := util.SplitManifests(out)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse rendered manifests: %w", err)
+	}
+
+	// Show what an empty render would delete, rather than kapp refusing.
+	if len(docs) == 0 {
+		args = append(args, "--dangerous-allow-empty-list-of-resources")
+	}
+
+	_, redaction := r.redactor.Redact(out)
+
+	var outBuf, errBuf bytes.Buffer
+	cmd := exec.Command(d.opts.KappPath, args...)
+	cmd.Stdin = bytes.NewReader(out)
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+
+	if err := util.RunCommand(ctx, cmd); err != nil {
+		return nil, "", fmt.Errorf("kapp diff failed: %w: %s", err, redaction.String(strings.TrimSpace(errBuf.String())))
+	}
+
+	plan, err := util.ParseKappPlan(outBuf.Bytes())
+	if err != nil {
+		return nil, "", err
+	}
+
+	diff, err := util.ParseKappDiff(outBuf.Bytes())
+	if err != nil {
+		return nil, "", err
+	}
+
+	return plan.Changes, redaction.String(diff), nil
+}
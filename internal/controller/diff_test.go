@@ -0,0 +1,95 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDiffer(t *testing.T) {
+	dir := t.TempDir()
+
+	// Stand ins for ytt (which fails for objects that ask it to) and kapp
+	// (which always plans to create a config map).
+	yttPath := filepath.Join(dir, "ytt")
+	require.NoError(t, os.WriteFile(yttPath, []byte(`#!/bin/sh
+input=$(cat)
+case "$input" in
+  *fail*) echo "boom" >&2; exit 1 ;;
+esac
+echo "$input"
+`), 0o755))
+
+	kappPath := filepath.Join(dir, "kapp")
+	require.NoError(t, os.WriteFile(kappPath, []byte(`#!/bin/sh
+cat >/dev/null
+echo '{"Tables": [{"Rows": [{"kind": "ConfigMap", "name": "derived", "namespace": "default", "op": "create"}]}], "Lines": ["@@ create configmap/derived (v1) namespace: default @@"]}'
+`), 0o755))
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "selected", Namespace: "default", Labels: map[string]string{"app": "db"}}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "unselected", Namespace: "default"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "paused", Namespace: "default", Labels: map[string]string{"app": "db"},
+			Annotations: map[string]string{pausedAnnotation: "true"}}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "fail", Namespace: "default", Labels: map[string]string{"app": "db"}}},
+	).Build()
+
+	spec := &v1beta1.ReconcilerSpec{
+		For:      []v1beta1.ReconcilerForSpec{{APIVersion: "v1", Kind: "ConfigMap"}},
+		Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+	}
+
+	diffs, err := NewDiffer(c, spec, dir, DiffOptions{
+		AppNamespace:      "operators",
+		QualifiedAppNames: true,
+		YTTPath:           yttPath,
+		KappPath:          kappPath,
+	}).Diff(context.Background())
+	require.NoError(t, err)
+	require.Len(t, diffs, 4)
+
+	assert.Equal(t, "fail", diffs[0].Name)
+	assert.Contains(t, diffs[0].Error, "boom")
+
+	assert.Equal(t, "paused", diffs[1].Name)
+	assert.NotEmpty(t, diffs[1].Skipped)
+
+	assert.Equal(t, "selected", diffs[2].Name)
+	assert.Equal(t, "ConfigMap", diffs[2].Kind)
+	assert.Equal(t, "configmap.default.selected", diffs[2].App)
+	assert.Empty(t, diffs[2].Error)
+	require.Len(t, diffs[2].Changes, 1)
+	assert.Equal(t, "ConfigMap/default/derived", diffs[2].Changes[0].String())
+	assert.Equal(t, "@@ create configmap/derived (v1) namespace: default @@", diffs[2].Diff)
+
+	assert.Equal(t, "unselected", diffs[3].Name)
+	assert.Equal(t, "Object is not selected", diffs[3].Skipped)
+}
@@ -0,0 +1,274 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// The condition a child reports in its reconcilers status while draining.
+const (
+	conditionDraining = "Draining"
+	reasonDrained     = "Drained"
+)
+
+// Drain tracks whether the reconciler that owns this process is being
+// deleted. While draining, every managed object is cleaned up (according to
+// its deletion policy) and has its finalizer removed.
+type Drain struct {
+	mu        sync.Mutex
+	since     time.Time
+	owner     string
+	listeners map[int]func()
+	nextID    int
+}
+
+// NewDrain creates a drain for the child of the given reconciler (or cluster
+// reconciler).
+func NewDrain(config client.Object) *Drain {
+	return &Drain{owner: ownerID(config.(reconcilerObject))}
+}
+
+// Owner returns the value of the owner label on the objects managed by the
+// child, only those are released while draining.
+func (d *Drain) Owner() string {
+	if d == nil {
+		return ""
+	}
+
+	return d.owner
+}
+
+// Since returns when draining started, and whether it has.
+func (d *Drain) Since() (time.Time, bool) {
+	if d == nil {
+		return time.Time{}, false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.since, !d.since.IsZero()
+}
+
+// OnStart registers a function to be called once draining starts. The
+// returned function unregisters it.
+func (d *Drain) OnStart(fn func()) func() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.listeners == nil {
+		d.listeners = map[int]func(){}
+	}
+
+	id := d.nextID
+	d.nextID++
+	d.listeners[id] = fn
+
+	return func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		delete(d.listeners, id)
+	}
+}
+
+func (d *Drain) start(since time.Time) {
+	d.mu.Lock()
+	if !d.since.IsZero() {
+		d.mu.Unlock()
+		return
+	}
+	d.since = since
+	listeners := make([]func(), 0, len(d.listeners))
+	for _, fn := range d.listeners {
+		listeners = append(listeners, fn)
+	}
+	d.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn()
+	}
+}
+
+// DrainReconciler watches the reconciler configuration of a child, and starts
+// draining once it has been marked for deletion. Progress is reported in the
+// reconcilers status, the parent waits for it before removing the child.
+type DrainReconciler struct {
+	client.Client
+	apiReader client.Reader
+	recorder  record.EventRecorder
+	// config is the reconciler (or cluster reconciler) the child runs.
+	config      client.Object
+	drain       *Drain
+	reconcilers []*YTTReconciler
+}
+
+func NewDrainReconciler(mgr ctrl.Manager, config client.Object, drain *Drain, reconcilers []*YTTReconciler) *DrainReconciler {
+	return &DrainReconciler{
+		Client:      mgr.GetClient(),
+		apiReader:   mgr.GetAPIReader(),
+		recorder:    mgr.GetEventRecorderFor("ytt-operator"),
+		config:      config,
+		drain:       drain,
+		reconcilers: reconcilers,
+	}
+}
+
+func (r *DrainReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	obj := r.config.DeepCopyObject().(reconcilerObject)
+	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+
+		return ctrl.Result{}, fmt.Errorf("failed to get object: %w", err)
+	}
+
+	if obj.GetDeletionTimestamp() == nil {
+		return ctrl.Result{}, nil
+	}
+
+	if _, draining := r.drain.Since(); !draining {
+		logger.Info("Reconciler is being deleted, releasing managed objects")
+	}
+
+	r.drain.start(obj.GetDeletionTimestamp().Time)
+
+	var remaining int32
+	for _, reconciler := range r.reconcilers {
+		n, err := reconciler.remaining(ctx, r.apiReader)
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to count managed objects: %w", err)
+		}
+
+		remaining += n
+	}
+
+	if err := r.updateStatus(ctx, obj, remaining); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to update status: %w", err)
+	}
+
+	if remaining > 0 {
+		logger.Info("Waiting for managed objects to be released", "remaining", remaining)
+
+		return ctrl.Result{RequeueAfter: drainPollInterval}, nil
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// updateStatus reports the progress of draining.
+func (r *DrainReconciler) updateStatus(ctx context.Context, obj reconcilerObject, remaining int32) error {
+	cond := metav1.Condition{
+		Type:    conditionDraining,
+		Status:  metav1.ConditionTrue,
+		Reason:  "WaitingForObjects",
+		Message: fmt.Sprintf("Waiting for %d managed objects to be released", remaining),
+	}
+
+	if remaining == 0 {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = reasonDrained
+		cond.Message = "All managed objects have been released"
+	}
+
+	existing := meta.FindStatusCondition(obj.GetReconcilerStatus().Conditions, cond.Type)
+	if existing != nil && existing.Status == cond.Status && existing.Message == cond.Message {
+		return nil
+	}
+
+	r.recorder.Event(obj, corev1.EventTypeNormal, cond.Reason, cond.Message)
+
+	clone := obj.DeepCopyObject().(reconcilerObject)
+	clone.GetReconcilerStatus().RemainingObjects = remaining
+	cond.ObservedGeneration = obj.GetGeneration()
+	meta.SetStatusCondition(&clone.GetReconcilerStatus().Conditions, cond)
+
+	return r.Status().Patch(ctx, clone, client.MergeFrom(obj))
+}
+
+func (r *DrainReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(r.config.DeepCopyObject().(client.Object), builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return obj.GetName() == r.config.GetName() && obj.GetNamespace() == r.config.GetNamespace()
+		}))).
+		Complete(r)
+}
+
+// remaining returns the number of objects this reconciler still has to
+// release. The API server is asked directly, so that we don't need to keep a
+// cache of every object around.
+func (r *YTTReconciler) remaining(ctx context.Context, reader client.Reader) (int32, error) {
+	mapping, err := r.RESTMapper().RESTMapping(r.gvk.GroupKind(), r.gvk.Version)
+	if err != nil {
+		// If the kind no longer exists, neither do its objects.
+		if meta.IsNoMatchError(err) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	namespaces := r.spec.Namespaces
+	if len(namespaces) == 0 || mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	var remaining int32
+	for _, ns := range namespaces {
+		var list metav1.PartialObjectMetadataList
+		list.SetGroupVersionKind(r.gvk.GroupVersion().WithKind(r.gvk.Kind + "List"))
+
+		if err := reader.List(ctx, &list, client.InNamespace(ns)); err != nil {
+			if errors.IsNotFound(err) {
+				return 0, nil
+			}
+
+			return 0, fmt.Errorf("failed to list %s: %w", r.gvk.String(), err)
+		}
+
+		for i := range list.Items {
+			released, err := r.releases(ctx, &list.Items[i])
+			if err != nil {
+				return 0, err
+			}
+
+			if released {
+				remaining++
+			}
+		}
+	}
+
+	return remaining, nil
+}
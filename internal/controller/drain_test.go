@@ -0,0 +1,149 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDrain(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+
+	config := &v1beta1.Reconciler{ObjectMeta: metav1.ObjectMeta{Name: "my-reconciler", Namespace: "default"}}
+	drain := NewDrain(config)
+
+	newObject := func(name string, labels map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name:       name,
+			Namespace:  "default",
+			Labels:     labels,
+			Finalizers: []string{finalizer},
+		}}
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithRESTMapper(mapper).WithObjects(
+		newObject("ours", map[string]string{ownerLabel: drain.Owner()}),
+		newObject("theirs", map[string]string{ownerLabel: "someone-else"}),
+		newObject("legacy", map[string]string{"app": "example"}),
+		newObject("legacy-unselected", nil),
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "unmanaged", Namespace: "default"}},
+	).Build()
+
+	spec := &v1beta1.ReconcilerSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "example"}}}
+	gvk := corev1.SchemeGroupVersion.WithKind("ConfigMap")
+
+	selector, err := newObjectSelector(spec, gvk)
+	require.NoError(t, err)
+
+	r := &YTTReconciler{Client: c, gvk: gvk, spec: spec, selector: selector, drain: drain}
+
+	ctx := context.Background()
+
+	get := func(name string) *unstructured.Unstructured {
+		var obj unstructured.Unstructured
+		obj.SetGroupVersionKind(gvk)
+		require.NoError(t, c.Get(ctx, client.ObjectKey{Name: name, Namespace: "default"}, &obj))
+		return &obj
+	}
+
+	t.Run("Releases", func(t *testing.T) {
+		for name, expected := range map[string]bool{
+			"ours":              true,
+			"theirs":            false,
+			"legacy":            true,
+			"legacy-unselected": false,
+			"unmanaged":         false,
+		} {
+			released, err := r.releases(ctx, get(name))
+			require.NoError(t, err)
+			assert.Equal(t, expected, released, name)
+		}
+
+		deleted := get("legacy-unselected")
+		deleted.SetDeletionTimestamp(&metav1.Time{Time: time.Now()})
+
+		released, err := r.releases(ctx, deleted)
+		require.NoError(t, err)
+		assert.True(t, released, "Deleted objects claimed before the owner label should be released")
+	})
+
+	t.Run("Observe", func(t *testing.T) {
+		observing := *r
+		observing.spec = spec.DeepCopy()
+		observing.spec.Mode = v1beta1.ReconcilerModeObserve
+
+		for name, expected := range map[string]bool{
+			"ours":   true,
+			"theirs": false,
+			"legacy": false,
+		} {
+			released, err := observing.releases(ctx, get(name))
+			require.NoError(t, err)
+			assert.Equal(t, expected, released, name)
+		}
+	})
+
+	t.Run("Remaining", func(t *testing.T) {
+		remaining, err := r.remaining(ctx, c)
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), remaining)
+	})
+
+	t.Run("Claim", func(t *testing.T) {
+		require.NoError(t, r.claim(ctx, get("legacy")))
+		assert.Equal(t, drain.Owner(), get("legacy").GetLabels()[ownerLabel])
+
+		require.NoError(t, r.claim(ctx, get("theirs")))
+		assert.Equal(t, "someone-else", get("theirs").GetLabels()[ownerLabel], "Objects should keep their owner")
+
+		require.NoError(t, r.claim(ctx, get("unmanaged")))
+		unmanaged := get("unmanaged")
+		assert.Contains(t, unmanaged.GetFinalizers(), finalizer)
+		assert.Equal(t, drain.Owner(), unmanaged.GetLabels()[ownerLabel])
+	})
+}
+
+func TestDrainOnStart(t *testing.T) {
+	drain := NewDrain(&v1beta1.Reconciler{ObjectMeta: metav1.ObjectMeta{Name: "my-reconciler", Namespace: "default"}})
+
+	var called []string
+	drain.OnStart(func() { called = append(called, "registered") })
+	unregister := drain.OnStart(func() { called = append(called, "unregistered") })
+	unregister()
+
+	drain.start(time.Now())
+	drain.start(time.Now())
+
+	assert.Equal(t, []string{"registered"}, called, "Listeners should be called once, unless unregistered")
+}
@@ -0,0 +1,283 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// discoveryPollInterval is how often we check whether kinds have been
+// installed (or removed).
+const discoveryPollInterval = 10 * time.Second
+
+// KindWatcher runs the reconciler of each kind while it is installed in the
+// cluster. Kinds that aren't installed yet (eg. their CRD is applied after
+// the reconciler) are started once they are, and stopped if they are removed.
+type KindWatcher struct {
+	mgr         ctrl.Manager
+	client      client.Client
+	discovery   discovery.DiscoveryInterface
+	config      client.Object
+	reconcilers []*YTTReconciler
+	newCache    cache.NewCacheFunc
+	trigger     chan struct{}
+
+	mu      sync.Mutex
+	running map[schema.GroupVersionKind]context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewKindWatcher creates a watcher for the reconcilers of a child. The config
+// is the reconcilers configuration, pending kinds are reported in its status
+// (config is nil when running against a local scripts directory).
+func NewKindWatcher(mgr ctrl.Manager, config client.Object, reconcilers []*YTTReconciler, newCache cache.NewCacheFunc) *KindWatcher {
+	return &KindWatcher{
+		mgr:         mgr,
+		client:      mgr.GetClient(),
+		config:      config,
+		reconcilers: reconcilers,
+		newCache:    newCache,
+		trigger:     make(chan struct{}, 1),
+		running:     make(map[schema.GroupVersionKind]context.CancelFunc),
+	}
+}
+
+func (w *KindWatcher) SetupWithManager(ctx context.Context, mgr ctrl.Manager) error {
+	var err error
+	w.discovery, err = discovery.NewDiscoveryClientForConfig(mgr.GetConfig())
+	if err != nil {
+		return fmt.Errorf("failed to create discovery client: %w", err)
+	}
+
+	// Watching CRDs lets us start reconcilers as soon as their kind is
+	// installed, but the child might not be allowed to. In which case we
+	// rely on polling discovery.
+	allowed, err := w.canWatchCRDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	if allowed {
+		groups := make(map[string]bool)
+		for _, r := range w.reconcilers {
+			groups[r.gvk.Group] = true
+		}
+
+		err := ctrl.NewControllerManagedBy(mgr).
+			Named("kind-watcher").
+			For(&apiextensionsv1.CustomResourceDefinition{}, builder.OnlyMetadata, builder.WithPredicates(
+				predicate.NewPredicateFuncs(func(obj client.Object) bool {
+					_, group, _ := strings.Cut(obj.GetName(), ".")
+					return groups[group]
+				}))).
+			Complete(reconcile.Func(func(context.Context, reconcile.Request) (reconcile.Result, error) {
+				w.Trigger()
+				return reconcile.Result{}, nil
+			}))
+		if err != nil {
+			return err
+		}
+	}
+
+	return mgr.Add(w)
+}
+
+// Trigger asks the watcher to check for installed kinds now.
+func (w *KindWatcher) Trigger() {
+	select {
+	case w.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Start checks for installed kinds until the context is cancelled.
+func (w *KindWatcher) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("kind-watcher")
+
+	ticker := time.NewTicker(discoveryPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.sync(ctx); err != nil {
+			logger.Error(err, "Failed to check for installed kinds")
+		}
+
+		select {
+		case <-ctx.Done():
+			// The reconcilers share our context, so they are already stopping.
+			w.wg.Wait()
+			return nil
+		case <-ticker.C:
+		case <-w.trigger:
+		}
+	}
+}
+
+// sync starts the reconcilers of newly installed kinds, and stops those of
+// removed kinds.
+func (w *KindWatcher) sync(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("kind-watcher")
+
+	var pending []string
+	for _, r := range w.reconcilers {
+		installed, err := w.installed(r.gvk)
+		if err != nil {
+			// Leave things as they are until discovery recovers.
+			return fmt.Errorf("failed to discover %s: %w", r.gvk.String(), err)
+		}
+
+		if !installed {
+			pending = append(pending, r.gvk.String())
+		}
+
+		w.mu.Lock()
+		cancel, running := w.running[r.gvk]
+		w.mu.Unlock()
+
+		switch {
+		case installed && !running:
+			logger.Info("Kind is installed, starting reconciler", "gvk", r.gvk.String())
+
+			w.start(ctx, r)
+		case !installed && running:
+			logger.Info("Kind has been removed, stopping reconciler", "gvk", r.gvk.String())
+
+			cancel()
+		}
+	}
+
+	return w.updatePendingKinds(ctx, pending)
+}
+
+// start runs a reconciler in the background, until either the kind is
+// removed or it fails (in which case it will be restarted by the next sync).
+func (w *KindWatcher) start(ctx context.Context, r *YTTReconciler) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	w.mu.Lock()
+	w.running[r.gvk] = cancel
+	w.mu.Unlock()
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer cancel()
+
+		if err := r.Start(ctx, w.mgr, w.newCache); err != nil {
+			log.FromContext(ctx).Error(err, "Reconciler failed", "gvk", r.gvk.String())
+		}
+
+		w.mu.Lock()
+		delete(w.running, r.gvk)
+		w.mu.Unlock()
+	}()
+}
+
+// installed returns true if the API server is serving the kind.
+func (w *KindWatcher) installed(gvk schema.GroupVersionKind) (bool, error) {
+	resources, err := w.discovery.ServerResourcesForGroupVersion(gvk.GroupVersion().String())
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	for _, res := range resources.APIResources {
+		// Skip subresources (eg. databases/status).
+		if res.Kind == gvk.Kind && !strings.Contains(res.Name, "/") {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// updatePendingKinds reports the kinds that aren't installed yet in the
+// status of the reconciler.
+func (w *KindWatcher) updatePendingKinds(ctx context.Context, pending []string) error {
+	// There is no reconciler to report to in development mode.
+	if w.config == nil {
+		if len(pending) > 0 {
+			log.FromContext(ctx).WithName("kind-watcher").Info("Waiting for kinds to be installed", "kinds", pending)
+		}
+
+		return nil
+	}
+
+	obj := w.config.DeepCopyObject().(reconcilerObject)
+	if err := w.client.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		return fmt.Errorf("failed to get reconciler: %w", err)
+	}
+
+	if equality.Semantic.DeepEqual(obj.GetReconcilerStatus().PendingKinds, pending) {
+		return nil
+	}
+
+	clone := obj.DeepCopyObject().(reconcilerObject)
+	clone.GetReconcilerStatus().PendingKinds = pending
+
+	if err := w.client.Status().Patch(ctx, clone, client.MergeFrom(obj)); err != nil {
+		return fmt.Errorf("failed to update pending kinds: %w", err)
+	}
+
+	return nil
+}
+
+// canWatchCRDs asks the API server whether we are allowed to watch CRDs.
+func (w *KindWatcher) canWatchCRDs(ctx context.Context) (bool, error) {
+	for _, verb := range []string{"list", "watch"} {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Group:    apiextensionsv1.GroupName,
+					Resource: "customresourcedefinitions",
+					Verb:     verb,
+				},
+			},
+		}
+
+		if err := w.client.Create(ctx, review); err != nil {
+			return false, fmt.Errorf("failed to review access to crds: %w", err)
+		}
+
+		if !review.Status.Allowed {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
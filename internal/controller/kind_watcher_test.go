@@ -0,0 +1,78 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestKindWatcher(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1beta1.AddToScheme(scheme))
+
+	config := &v1beta1.Reconciler{
+		ObjectMeta: metav1.ObjectMeta{Name: "databases", Namespace: "default"},
+	}
+
+	discovery := &fake.FakeDiscovery{Fake: &k8stesting.Fake{}}
+	discovery.Resources = []*metav1.APIResourceList{{
+		GroupVersion: "example.com/v1",
+		APIResources: []metav1.APIResource{
+			{Name: "databases", Kind: "Database"},
+			{Name: "caches/status", Kind: "Cache"},
+		},
+	}}
+
+	w := &KindWatcher{
+		client:    fakeclient.NewClientBuilder().WithScheme(scheme).WithObjects(config).Build(),
+		discovery: discovery,
+		config:    config,
+		reconcilers: []*YTTReconciler{
+			{gvk: schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Cache"}},
+			{gvk: schema.GroupVersionKind{Group: "example.org", Version: "v1", Kind: "Queue"}},
+		},
+		running: make(map[schema.GroupVersionKind]context.CancelFunc),
+	}
+
+	installed, err := w.installed(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Database"})
+	require.NoError(t, err)
+	assert.True(t, installed)
+
+	installed, err = w.installed(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Cache"})
+	require.NoError(t, err)
+	assert.False(t, installed, "Subresources shouldn't count as the kind being installed")
+
+	ctx := context.Background()
+	require.NoError(t, w.sync(ctx))
+
+	var updated v1beta1.Reconciler
+	require.NoError(t, w.client.Get(ctx, client.ObjectKeyFromObject(config), &updated))
+	assert.Equal(t, []string{"example.com/v1, Kind=Cache", "example.org/v1, Kind=Queue"}, updated.Status.PendingKinds)
+	assert.Empty(t, w.running, "Nothing should be started for kinds that aren't installed")
+}
@@ -0,0 +1,253 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// reasonPendingChanges is the event reason for changes found in the Observe mode.
+const reasonPendingChanges = "PendingChanges"
+
+// maxPendingChanges bounds the size of a reconcilers status, objects past the
+// limit are only reported as events.
+const maxPendingChanges = 100
+
+// observe works out what reconciling an object would change, without
+// changing anything. Pending changes are reported as a condition on the
+// object, which is otherwise left alone (so that an observing reconciler can
+// shadow the one that is actually managing it).
+func (r *YTTReconciler) observe(ctx context.Context, obj *unstructured.Unstructured) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if message := r.pausedMessage(obj); message != "" {
+		logger.Info("Reconciliation paused", "reason", message)
+
+		return ctrl.Result{}, r.clearPendingChanges(ctx, obj)
+	}
+
+	// Deleted objects are left to whoever is managing them.
+	if obj.GetDeletionTimestamp() != nil {
+		return ctrl.Result{}, r.clearPendingChanges(ctx, obj)
+	}
+
+	selected, err := r.selector.Matches(ctx, r.Client, obj)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to match object: %w", err)
+	}
+
+	if !selected {
+		logger.Info("Object not selected, skipping")
+
+		return ctrl.Result{}, r.clearPendingChanges(ctx, obj)
+	}
+
+	// Render the object as it would be when applying, with our finalizer.
+	withFinalizer := obj.DeepCopy()
+	controllerutil.AddFinalizer(withFinalizer, finalizer)
+
+	out, err := r.render(ctx, withFinalizer)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	check, err := r.checkSafety(ctx, obj, out)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	plan := check.plan
+	if plan == nil {
+		plan, err = r.plan(ctx, obj, out, check.empty)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if len(plan.Changes) == 0 {
+		logger.Info("Observed no changes")
+
+		return ctrl.Result{}, r.clearPendingChanges(ctx, obj)
+	}
+
+	summary := plan.Summary()
+	if check.reason != "" {
+		summary = check.message + ": " + summary
+	}
+
+	logger.Info("Observed pending changes", "plan", plan.Hash(), "summary", summary)
+
+	changed, err := setCondition(ctx, r.Client, obj, metav1.Condition{
+		Type:    conditionPendingChanges,
+		Status:  metav1.ConditionTrue,
+		Reason:  reasonPendingChanges,
+		Message: "Plan " + plan.Hash() + ": " + summary,
+	}, false)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to update status: %w", err)
+	}
+
+	// The reconcilers status aggregates the pending changes of every object.
+	recorded, err := r.changes.Record(ctx, v1beta1.ReconcilerPendingChange{
+		APIVersion: r.gvk.GroupVersion().String(),
+		Kind:       r.gvk.Kind,
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+		Plan:       plan.Hash(),
+		Summary:    summary,
+	})
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Only report each plan once.
+	if changed || recorded {
+		r.recorder.Event(obj, corev1.EventTypeNormal, reasonPendingChanges, summary)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// clearPendingChanges removes the pending changes reported for an object.
+func (r *YTTReconciler) clearPendingChanges(ctx context.Context, obj *unstructured.Unstructured) error {
+	if _, err := setCondition(ctx, r.Client, obj, metav1.Condition{Type: conditionPendingChanges}, true); err != nil {
+		return fmt.Errorf("failed to update status: %w", err)
+	}
+
+	return r.changes.Clear(ctx, r.gvk, client.ObjectKeyFromObject(obj))
+}
+
+// ChangeReporter records the pending changes of observed objects in the
+// status of a reconciler. A nil reporter (eg. in development mode) only
+// reports changes as events.
+type ChangeReporter struct {
+	client client.Client
+	config client.Object
+}
+
+// NewChangeReporter creates a reporter for a childs reconciler configuration.
+func NewChangeReporter(c client.Client, config client.Object) *ChangeReporter {
+	return &ChangeReporter{
+		client: c,
+		config: config,
+	}
+}
+
+// Record sets the pending changes of an object. It returns true if the
+// changes hadn't already been recorded.
+func (cr *ChangeReporter) Record(ctx context.Context, change v1beta1.ReconcilerPendingChange) (bool, error) {
+	if cr == nil {
+		return true, nil
+	}
+
+	recorded := false
+	err := cr.update(ctx, func(changes []v1beta1.ReconcilerPendingChange) []v1beta1.ReconcilerPendingChange {
+		i := findPendingChange(changes, change.APIVersion, change.Kind, change.Namespace, change.Name)
+		if i >= 0 {
+			recorded = changes[i] != change
+			changes[i] = change
+			return changes
+		}
+
+		recorded = true
+		return append(changes, change)
+	})
+
+	return recorded, err
+}
+
+// Clear removes any pending changes recorded for an object.
+func (cr *ChangeReporter) Clear(ctx context.Context, gvk schema.GroupVersionKind, key types.NamespacedName) error {
+	if cr == nil {
+		return nil
+	}
+
+	return cr.update(ctx, func(changes []v1beta1.ReconcilerPendingChange) []v1beta1.ReconcilerPendingChange {
+		if i := findPendingChange(changes, gvk.GroupVersion().String(), gvk.Kind, key.Namespace, key.Name); i >= 0 {
+			return append(changes[:i], changes[i+1:]...)
+		}
+
+		return changes
+	})
+}
+
+// update modifies the pending changes, several reconcilers (and workers)
+// share the status so conflicting updates are retried.
+func (cr *ChangeReporter) update(ctx context.Context, fn func([]v1beta1.ReconcilerPendingChange) []v1beta1.ReconcilerPendingChange) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj := cr.config.DeepCopyObject().(reconcilerObject)
+		if err := cr.client.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			return fmt.Errorf("failed to get reconciler: %w", err)
+		}
+
+		existing := obj.GetReconcilerStatus().PendingChanges
+
+		changes := fn(append([]v1beta1.ReconcilerPendingChange(nil), existing...))
+		sort.Slice(changes, func(i, j int) bool {
+			return pendingChangeKey(changes[i]) < pendingChangeKey(changes[j])
+		})
+		if len(changes) > maxPendingChanges {
+			changes = changes[:maxPendingChanges]
+		}
+
+		if equality.Semantic.DeepEqual(existing, changes) || (len(existing) == 0 && len(changes) == 0) {
+			return nil
+		}
+
+		clone := obj.DeepCopyObject().(reconcilerObject)
+		clone.GetReconcilerStatus().PendingChanges = changes
+
+		return cr.client.Status().Patch(ctx, clone, client.MergeFromWithOptions(obj, client.MergeFromWithOptimisticLock{}))
+	})
+}
+
+func findPendingChange(changes []v1beta1.ReconcilerPendingChange, apiVersion, kind, namespace, name string) int {
+	for i, c := range changes {
+		if c.APIVersion == apiVersion && c.Kind == kind && c.Namespace == namespace && c.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func pendingChangeKey(c v1beta1.ReconcilerPendingChange) string {
+	return c.APIVersion + "/" + c.Kind + "/" + c.Namespace + "/" + c.Name
+}
+
+// claimed returns true if this reconciler added our finalizer to an object,
+// eg. before it was switched to the Observe mode.
+func (r *YTTReconciler) claimed(obj client.Object) bool {
+	owner := r.drain.Owner()
+
+	return owner != "" && obj.GetLabels()[ownerLabel] == owner && controllerutil.ContainsFinalizer(obj, finalizer)
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dpeckett/ytt-operator/api/v1alpha1"
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestChangeReporter(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1beta1.AddToScheme(scheme))
+
+	config := &v1beta1.Reconciler{
+		ObjectMeta: metav1.ObjectMeta{Name: "databases", Namespace: "default"},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(config).Build()
+	cr := NewChangeReporter(c, config)
+
+	ctx := context.Background()
+
+	change := v1beta1.ReconcilerPendingChange{
+		APIVersion: "example.com/v1",
+		Kind:       "Database",
+		Namespace:  "team-b",
+		Name:       "my-db",
+		Plan:       "0123456789abcdef",
+		Summary:    "1 to create (ConfigMap/team-b/my-db)",
+	}
+
+	recorded, err := cr.Record(ctx, change)
+	require.NoError(t, err)
+	assert.True(t, recorded)
+
+	recorded, err = cr.Record(ctx, change)
+	require.NoError(t, err)
+	assert.False(t, recorded, "The same plan shouldn't be reported twice")
+
+	other := change
+	other.Namespace = "team-a"
+	_, err = cr.Record(ctx, other)
+	require.NoError(t, err)
+
+	var updated v1beta1.Reconciler
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(config), &updated))
+	assert.Equal(t, []v1beta1.ReconcilerPendingChange{other, change}, updated.Status.PendingChanges, "Changes should be sorted")
+
+	gvk := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Database"}
+	require.NoError(t, cr.Clear(ctx, gvk, types.NamespacedName{Namespace: "team-a", Name: "my-db"}))
+
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(config), &updated))
+	assert.Equal(t, []v1beta1.ReconcilerPendingChange{change}, updated.Status.PendingChanges)
+
+	t.Run("Nil", func(t *testing.T) {
+		var cr *ChangeReporter
+
+		recorded, err := cr.Record(ctx, change)
+		require.NoError(t, err)
+		assert.True(t, recorded, "Without a reconciler, changes are still reported as events")
+		assert.NoError(t, cr.Clear(ctx, gvk, types.NamespacedName{Namespace: "team-b", Name: "my-db"}))
+	})
+}
+
+func TestClearPendingChanges(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+	require.NoError(t, v1beta1.AddToScheme(scheme))
+
+	gvk := v1alpha1.GroupVersion.WithKind("TestResource")
+
+	config := &v1beta1.Reconciler{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+		Status: v1beta1.ReconcilerStatus{
+			PendingChanges: []v1beta1.ReconcilerPendingChange{{
+				APIVersion: gvk.GroupVersion().String(),
+				Kind:       gvk.Kind,
+				Namespace:  "default",
+				Name:       "test",
+				Plan:       "0123456789abcdef",
+				Summary:    "1 to create (ConfigMap/default/test)",
+			}},
+		},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(config, &v1alpha1.TestResource{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+		Status: v1alpha1.TestResourceStatus{
+			Conditions: []metav1.Condition{{
+				Type:               conditionPendingChanges,
+				Status:             metav1.ConditionTrue,
+				Reason:             reasonPendingChanges,
+				Message:            "Plan 0123456789abcdef: 1 to create (ConfigMap/default/test)",
+				LastTransitionTime: metav1.Now(),
+			}},
+		},
+	}).Build()
+
+	r := &YTTReconciler{Client: c, gvk: gvk, changes: NewChangeReporter(c, config)}
+
+	ctx := context.Background()
+
+	var obj unstructured.Unstructured
+	obj.SetGroupVersionKind(gvk)
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Name: "test", Namespace: "default"}, &obj))
+
+	require.NoError(t, r.clearPendingChanges(ctx, &obj))
+
+	var updated v1alpha1.TestResource
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(&obj), &updated))
+	assert.Nil(t, meta.FindStatusCondition(updated.Status.Conditions, conditionPendingChanges))
+
+	var updatedConfig v1beta1.Reconciler
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(config), &updatedConfig))
+	assert.Empty(t, updatedConfig.Status.PendingChanges)
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/dpeckett/ytt-operator/internal/util"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// orphan marks the resources currently owned by an objects app, so that kapp
+// leaves them in place when the app is deleted (removing its ownership
+// labels). The live resources are annotated directly, deploying a fresh
+// render could prune (or create, or modify) resources.
+func (r *YTTReconciler) orphan(ctx context.Context, obj *unstructured.Unstructured) error {
+	logger := log.FromContext(ctx)
+
+	logger.Info("Orphaning object resources")
+
+	var outBuf, errBuf bytes.Buffer
+	cmd := exec.Command("kapp", "inspect", "-a", r.appName(obj), "--raw", "--tty=false")
+	cmd.Stdout = &outBuf
+	cmd.Stderr = io.MultiWriter(&errBuf, util.NewKappLogInterceptor(logger, true, nil))
+
+	if err := r.run(ctx, cmd, durationOf(r.timeouts().Delete)); err != nil {
+		// Nothing to orphan if the app was never deployed.
+		if strings.Contains(errBuf.String(), "does not exist") {
+			return nil
+		}
+
+		r.recordFailure(obj, reasonDeleteFailed, fmt.Errorf("kapp inspect failed: %w", err))
+
+		return fmt.Errorf("kapp inspect failed: %w", err)
+	}
+
+	resources, err := util.DecodeManifests(&outBuf)
+	if err != nil {
+		return fmt.Errorf("failed to parse kapp inspect output: %w", err)
+	}
+
+	patch := client.RawPatch(types.MergePatchType,
+		[]byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:"orphan"}}}`, kappDeleteStrategyAnnotation)))
+
+	for _, res := range resources {
+		// Resources created by other resources (eg. pods) stay with their owner.
+		if len(res.GetOwnerReferences()) > 0 || res.GetAnnotations()[kappDeleteStrategyAnnotation] == "orphan" {
+			continue
+		}
+
+		target := &unstructured.Unstructured{}
+		target.SetGroupVersionKind(res.GroupVersionKind())
+		target.SetNamespace(res.GetNamespace())
+		target.SetName(res.GetName())
+
+		if err := r.Patch(ctx, target, patch); err != nil && !errors.IsNotFound(err) {
+			err = fmt.Errorf("failed to orphan %s: %w", resourceName(res), err)
+			r.recordFailure(obj, reasonDeleteFailed, err)
+
+			return err
+		}
+	}
+
+	return nil
+}
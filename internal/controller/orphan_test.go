@@ -0,0 +1,106 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	"github.com/dpeckett/ytt-operator/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestOrphan(t *testing.T) {
+	dir := t.TempDir()
+
+	// A stand in for kapp, which lists the resources of the "my-db" app.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "kapp"), []byte(`#!/bin/sh
+case "$*" in
+  *"-a my-db "*) ;;
+  *) echo "kapp: Error: App 'other' (namespace: default) does not exist" >&2; exit 1 ;;
+esac
+cat <<EOF
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: derived
+  namespace: default
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: derived-abc
+  namespace: default
+  ownerReferences:
+  - apiVersion: apps/v1
+    kind: ReplicaSet
+    name: derived
+    uid: "1234"
+EOF
+`), 0o755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "derived", Namespace: "default"}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "derived-abc", Namespace: "default"}},
+	).Build()
+
+	r := &YTTReconciler{
+		Client:   c,
+		spec:     &v1beta1.ReconcilerSpec{},
+		pool:     util.NewProcessPool(1, 0),
+		recorder: record.NewFakeRecorder(10),
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("example.com/v1")
+	obj.SetKind("Database")
+	obj.SetNamespace("default")
+	obj.SetName("my-db")
+
+	ctx := context.Background()
+	require.NoError(t, r.orphan(ctx, obj))
+
+	var cm corev1.ConfigMap
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Name: "derived", Namespace: "default"}, &cm))
+	assert.Equal(t, "orphan", cm.Annotations[kappDeleteStrategyAnnotation])
+
+	var pod corev1.Pod
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Name: "derived-abc", Namespace: "default"}, &pod))
+	assert.Empty(t, pod.Annotations, "Resources with owners should be left alone")
+
+	t.Run("Never deployed", func(t *testing.T) {
+		obj := obj.DeepCopy()
+		obj.SetName("other")
+
+		assert.NoError(t, r.orphan(ctx, obj), "There is nothing to orphan if the app doesn't exist")
+	})
+}
@@ -0,0 +1,386 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// rbacOwnerLabel is set on generated RBAC objects, its value identifies the
+// reconciler they were generated for.
+const rbacOwnerLabel = "ytt-operator.pecke.tt/rbac-owner"
+
+// Verbs granted to the child.
+var (
+	readVerbs   = []string{"get", "list", "watch"}
+	forVerbs    = []string{"get", "list", "watch", "update", "patch"}
+	statusVerbs = []string{"get", "update", "patch"}
+	outputVerbs = []string{"get", "list", "watch", "create", "update", "patch", "delete"}
+	eventVerbs  = []string{"create", "patch"}
+)
+
+//+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;clusterroles,verbs=get;list;watch;create;update;patch;delete;bind;escalate
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=rolebindings;clusterrolebindings,verbs=get;list;watch;create;update;patch;delete
+
+// rbacRules are the permissions a child needs, grouped by where they are granted.
+type rbacRules struct {
+	// own rules are granted in the childs namespace.
+	own []rbacv1.PolicyRule
+	// watched rules are granted in each of the reconcilers watched
+	// namespaces, or cluster wide if it isn't restricted to any.
+	watched []rbacv1.PolicyRule
+	// cluster rules are always granted cluster wide.
+	cluster []rbacv1.PolicyRule
+	// pending are the for kinds that aren't installed yet, and so have no
+	// rules (as their resource isn't known).
+	pending []schema.GroupVersionKind
+}
+
+// generatesRBAC returns true if the reconcilers service account is generated.
+func generatesRBAC(spec *v1beta1.ReconcilerSpec) bool {
+	return spec.RBAC != nil && spec.RBAC.Generate
+}
+
+// serviceAccountName returns the service account the child runs as.
+func serviceAccountName(obj reconcilerObject) string {
+	if generatesRBAC(obj.GetReconcilerSpec()) {
+		return childKey(obj).Name
+	}
+
+	return obj.GetReconcilerSpec().ServiceAccountName
+}
+
+// rbacName returns the name of the generated roles and bindings. Cluster
+// roles share a namespace with every reconciler, so the name is qualified.
+func rbacName(obj reconcilerObject) string {
+	if _, ok := obj.(*v1beta1.ClusterReconciler); ok {
+		return "ytt-operator:clusterreconciler:" + obj.GetName()
+	}
+
+	return "ytt-operator:reconciler:" + obj.GetNamespace() + ":" + obj.GetName()
+}
+
+// ownerID identifies a reconciler in the labels of objects generated for it
+// (names can be longer than a label value allows).
+func ownerID(obj reconcilerObject) string {
+	sum := sha256.Sum256([]byte(rbacName(obj)))
+	return hex.EncodeToString(sum[:])[:32]
+}
+
+// rbacRules works out the permissions needed by the child of a reconciler.
+func (r *ReconcilerReconciler) rbacRules(obj reconcilerObject) (*rbacRules, error) {
+	spec := obj.GetReconcilerSpec()
+
+	rules := &rbacRules{
+		own: []rbacv1.PolicyRule{
+			// Kapp keeps its app records in config maps.
+			{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: outputVerbs},
+			// For leader election.
+			{APIGroups: []string{"coordination.k8s.io"}, Resources: []string{"leases"}, Verbs: outputVerbs},
+			{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: eventVerbs},
+		},
+	}
+
+	// The childs own configuration.
+	configRule := rbacv1.PolicyRule{
+		APIGroups:     []string{v1beta1.GroupVersion.Group},
+		Resources:     []string{"reconcilers"},
+		ResourceNames: []string{obj.GetName()},
+		Verbs:         readVerbs,
+	}
+	// Kinds that aren't installed yet are reported in its status.
+	configStatusRule := rbacv1.PolicyRule{
+		APIGroups:     []string{v1beta1.GroupVersion.Group},
+		Resources:     []string{"reconcilers/status"},
+		ResourceNames: []string{obj.GetName()},
+		Verbs:         statusVerbs,
+	}
+	if _, ok := obj.(*v1beta1.ClusterReconciler); ok {
+		configRule.Resources = []string{"clusterreconcilers"}
+		configStatusRule.Resources = []string{"clusterreconcilers/status"}
+		rules.cluster = append(rules.cluster, configRule, configStatusRule)
+	} else {
+		rules.own = append(rules.own, configRule, configStatusRule)
+	}
+
+	// So that kinds are picked up as soon as they are installed.
+	rules.cluster = append(rules.cluster, rbacv1.PolicyRule{
+		APIGroups: []string{apiextensionsv1.GroupName},
+		Resources: []string{"customresourcedefinitions"},
+		Verbs:     readVerbs,
+	})
+
+	// Events are recorded against the reconciled objects (or in the default
+	// namespace for cluster scoped objects).
+	eventRule := rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: eventVerbs}
+	rules.watched = append(rules.watched, eventRule)
+
+	for _, t := range spec.For {
+		resource, clusterScoped, err := r.forResource(t)
+		if err != nil {
+			if meta.IsNoMatchError(err) {
+				rules.pending = append(rules.pending, t.GroupVersionKind())
+				continue
+			}
+
+			return nil, err
+		}
+
+		rule := rbacv1.PolicyRule{
+			APIGroups: []string{resource.Group},
+			Resources: []string{resource.Resource},
+			Verbs:     forVerbs,
+		}
+		statusRule := rbacv1.PolicyRule{
+			APIGroups: []string{resource.Group},
+			Resources: []string{resource.Resource + "/status"},
+			Verbs:     statusVerbs,
+		}
+
+		if clusterScoped {
+			rules.cluster = append(rules.cluster, rule, statusRule, eventRule)
+		} else {
+			rules.watched = append(rules.watched, rule, statusRule)
+		}
+	}
+
+	for _, t := range spec.RBAC.Outputs {
+		mapping, err := r.restMapping(t.GroupVersionKind())
+		if err != nil {
+			return nil, err
+		}
+
+		rule := rbacv1.PolicyRule{
+			APIGroups: []string{mapping.Resource.Group},
+			Resources: []string{mapping.Resource.Resource},
+			Verbs:     outputVerbs,
+		}
+
+		if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+			rules.cluster = append(rules.cluster, rule)
+		} else {
+			rules.watched = append(rules.watched, rule)
+		}
+	}
+
+	if spec.NamespaceSelector != nil {
+		rules.cluster = append(rules.cluster, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"namespaces"},
+			Verbs:     readVerbs,
+		})
+	}
+
+	return rules, nil
+}
+
+// forResource returns the resource of a for kind, and whether it is cluster
+// scoped. Kinds defined by the reconciler might not be installed yet, so
+// their definition is used instead.
+func (r *ReconcilerReconciler) forResource(t v1beta1.ReconcilerForSpec) (schema.GroupVersionResource, bool, error) {
+	gvk := t.GroupVersionKind()
+
+	if t.Definition != nil {
+		return gvk.GroupVersion().WithResource(t.Plural()), t.Definition.Scope == apiextensionsv1.ClusterScoped, nil
+	}
+
+	mapping, err := r.restMapping(gvk)
+	if err != nil {
+		return schema.GroupVersionResource{}, false, err
+	}
+
+	return mapping.Resource, mapping.Scope.Name() == meta.RESTScopeNameRoot, nil
+}
+
+func (r *ReconcilerReconciler) restMapping(gvk schema.GroupVersionKind) (*meta.RESTMapping, error) {
+	mapping, err := r.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map %s to a resource: %w", gvk.String(), err)
+	}
+
+	return mapping, nil
+}
+
+// reconcileRBAC creates (or updates) the service account, roles and bindings
+// for a reconcilers child, and removes any that are no longer needed. It
+// returns the for kinds that couldn't be granted as they aren't installed.
+func (r *ReconcilerReconciler) reconcileRBAC(ctx context.Context, obj reconcilerObject) ([]schema.GroupVersionKind, error) {
+	spec := obj.GetReconcilerSpec()
+	if !generatesRBAC(spec) {
+		return nil, r.deleteRBAC(ctx, obj, nil)
+	}
+
+	rules, err := r.rbacRules(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	key := childKey(obj)
+	name := rbacName(obj)
+	subjects := []rbacv1.Subject{{
+		Kind:      rbacv1.ServiceAccountKind,
+		Name:      key.Name,
+		Namespace: key.Namespace,
+	}}
+
+	var keep []client.Object
+
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+	if err := r.applyRBACObject(ctx, obj, sa, func() {}); err != nil {
+		return nil, err
+	}
+	keep = append(keep, sa)
+
+	namespaceRules := map[string][]rbacv1.PolicyRule{
+		key.Namespace: append([]rbacv1.PolicyRule{}, rules.own...),
+	}
+	clusterRules := rules.cluster
+
+	// A Reconciler is never granted access to every namespace, that is
+	// what ClusterReconcilers are for.
+	if watched := obj.GetWatchedNamespaces(); len(watched) > 0 {
+		for _, ns := range watched {
+			namespaceRules[ns] = append(namespaceRules[ns], rules.watched...)
+		}
+	} else {
+		clusterRules = append(clusterRules, rules.watched...)
+	}
+
+	namespaces := make([]string, 0, len(namespaceRules))
+	for ns := range namespaceRules {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	for _, ns := range namespaces {
+		role := &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns}}
+		if err := r.applyRBACObject(ctx, obj, role, func() { role.Rules = namespaceRules[ns] }); err != nil {
+			return nil, err
+		}
+
+		binding := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns}}
+		err := r.applyRBACObject(ctx, obj, binding, func() {
+			binding.RoleRef = rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: name}
+			binding.Subjects = subjects
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		keep = append(keep, role, binding)
+	}
+
+	if len(clusterRules) > 0 {
+		role := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if err := r.applyRBACObject(ctx, obj, role, func() { role.Rules = clusterRules }); err != nil {
+			return nil, err
+		}
+
+		binding := &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		err := r.applyRBACObject(ctx, obj, binding, func() {
+			binding.RoleRef = rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: name}
+			binding.Subjects = subjects
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		keep = append(keep, role, binding)
+	}
+
+	return rules.pending, r.deleteRBAC(ctx, obj, keep)
+}
+
+// applyRBACObject creates or updates a generated RBAC object.
+func (r *ReconcilerReconciler) applyRBACObject(ctx context.Context, owner reconcilerObject, obj client.Object, mutate func()) error {
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, obj, func() error {
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[rbacOwnerLabel] = ownerID(owner)
+		obj.SetLabels(labels)
+
+		mutate()
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to patch %T %s: %w", obj, client.ObjectKeyFromObject(obj), err)
+	}
+
+	return nil
+}
+
+// deleteRBAC removes the RBAC objects generated for a reconciler, other than
+// those in keep. Namespaced reconcilers can't own cluster scoped (or other
+// namespaces) objects, so we find them by label rather than relying on
+// garbage collection.
+func (r *ReconcilerReconciler) deleteRBAC(ctx context.Context, obj reconcilerObject, keep []client.Object) error {
+	kept := make(map[string]bool, len(keep))
+	for _, o := range keep {
+		kept[fmt.Sprintf("%T %s", o, client.ObjectKeyFromObject(o))] = true
+	}
+
+	lists := []client.ObjectList{
+		&corev1.ServiceAccountList{},
+		&rbacv1.RoleList{},
+		&rbacv1.RoleBindingList{},
+		&rbacv1.ClusterRoleList{},
+		&rbacv1.ClusterRoleBindingList{},
+	}
+
+	for _, list := range lists {
+		if err := r.List(ctx, list, client.MatchingLabels{rbacOwnerLabel: ownerID(obj)}); err != nil {
+			return fmt.Errorf("failed to list %T: %w", list, err)
+		}
+
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return fmt.Errorf("failed to extract %T: %w", list, err)
+		}
+
+		for _, item := range items {
+			o := item.(client.Object)
+			if kept[fmt.Sprintf("%T %s", o, client.ObjectKeyFromObject(o))] {
+				continue
+			}
+
+			if err := r.Delete(ctx, o); err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete %T %s: %w", o, client.ObjectKeyFromObject(o), err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReconcileRBAC(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, rbacv1.AddToScheme(scheme))
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Database"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Cluster"}, meta.RESTScopeRoot)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Secret"), meta.RESTScopeNamespace)
+
+	r := &ReconcilerReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).Build(),
+		mapper: mapper,
+	}
+
+	obj := &v1beta1.Reconciler{
+		ObjectMeta: metav1.ObjectMeta{Name: "databases", Namespace: "operators"},
+		Spec: v1beta1.ReconcilerSpec{
+			For:        []v1beta1.ReconcilerForSpec{{APIVersion: "example.com/v1", Kind: "Database"}},
+			Namespaces: []string{"team-a", "team-b"},
+			RBAC: &v1beta1.ReconcilerRBACSpec{
+				Generate: true,
+				Outputs: []v1beta1.ReconcilerKindSpec{
+					{APIVersion: "v1", Kind: "Secret"},
+					{APIVersion: "example.com/v1", Kind: "Cluster"},
+				},
+			},
+		},
+	}
+
+	ctx := context.Background()
+	pending, err := r.reconcileRBAC(ctx, obj)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	assert.Equal(t, "ytt-operator-databases", serviceAccountName(obj))
+
+	var sa corev1.ServiceAccount
+	require.NoError(t, r.Get(ctx, client.ObjectKey{Name: "ytt-operator-databases", Namespace: "operators"}, &sa))
+
+	name := rbacName(obj)
+
+	var role rbacv1.Role
+	require.NoError(t, r.Get(ctx, client.ObjectKey{Name: name, Namespace: "team-a"}, &role))
+	assert.Contains(t, role.Rules, rbacv1.PolicyRule{APIGroups: []string{"example.com"}, Resources: []string{"databases"}, Verbs: forVerbs})
+	assert.Contains(t, role.Rules, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: outputVerbs})
+
+	require.NoError(t, r.Get(ctx, client.ObjectKey{Name: name, Namespace: "operators"}, &role))
+	assert.Contains(t, role.Rules, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: outputVerbs},
+		"Kapp needs to manage its config maps in the childs namespace")
+	assert.NotContains(t, role.Rules, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: outputVerbs})
+
+	var clusterRole rbacv1.ClusterRole
+	require.NoError(t, r.Get(ctx, client.ObjectKey{Name: name}, &clusterRole))
+	assert.Contains(t, clusterRole.Rules, rbacv1.PolicyRule{APIGroups: []string{"example.com"}, Resources: []string{"clusters"}, Verbs: outputVerbs})
+	assert.NotContains(t, clusterRole.Rules, rbacv1.PolicyRule{APIGroups: []string{"example.com"}, Resources: []string{"databases"}, Verbs: forVerbs},
+		"Namespaced kinds shouldn't be granted cluster wide")
+
+	var binding rbacv1.ClusterRoleBinding
+	require.NoError(t, r.Get(ctx, client.ObjectKey{Name: name}, &binding))
+	assert.Equal(t, []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "ytt-operator-databases", Namespace: "operators"}}, binding.Subjects)
+
+	t.Run("Stale namespaces", func(t *testing.T) {
+		obj.Spec.Namespaces = []string{"team-a"}
+		_, err := r.reconcileRBAC(ctx, obj)
+		require.NoError(t, err)
+
+		var roles rbacv1.RoleList
+		require.NoError(t, r.List(ctx, &roles))
+
+		var namespaces []string
+		for _, role := range roles.Items {
+			namespaces = append(namespaces, role.Namespace)
+		}
+		assert.ElementsMatch(t, []string{"operators", "team-a"}, namespaces)
+	})
+
+	t.Run("Pending kinds", func(t *testing.T) {
+		withQueue := obj.DeepCopy()
+		withQueue.Spec.For = append(withQueue.Spec.For, v1beta1.ReconcilerForSpec{APIVersion: "example.com/v1", Kind: "Queue"})
+
+		pending, err := r.reconcileRBAC(ctx, withQueue)
+		require.NoError(t, err, "Kinds that aren't installed yet shouldn't stop the rest from being granted")
+		assert.Equal(t, []schema.GroupVersionKind{{Group: "example.com", Version: "v1", Kind: "Queue"}}, pending)
+	})
+
+	t.Run("Own namespace", func(t *testing.T) {
+		obj := obj.DeepCopy()
+		obj.Name = "caches"
+		obj.Spec.Namespaces = nil
+
+		_, err := r.reconcileRBAC(ctx, obj)
+		require.NoError(t, err)
+
+		name := rbacName(obj)
+
+		var role rbacv1.Role
+		require.NoError(t, r.Get(ctx, client.ObjectKey{Name: name, Namespace: "operators"}, &role))
+		assert.Contains(t, role.Rules, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: outputVerbs})
+
+		var clusterRole rbacv1.ClusterRole
+		require.NoError(t, r.Get(ctx, client.ObjectKey{Name: name}, &clusterRole))
+		assert.NotContains(t, clusterRole.Rules, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: outputVerbs},
+			"A Reconciler shouldn't be granted access to every namespace")
+
+		require.NoError(t, r.deleteRBAC(ctx, obj, nil))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		require.NoError(t, r.deleteRBAC(ctx, obj, nil))
+
+		for _, list := range []client.ObjectList{
+			&corev1.ServiceAccountList{},
+			&rbacv1.RoleList{},
+			&rbacv1.RoleBindingList{},
+			&rbacv1.ClusterRoleList{},
+			&rbacv1.ClusterRoleBindingList{},
+		} {
+			require.NoError(t, r.List(ctx, list))
+			assert.Zero(t, meta.LenList(list), "%T should be empty", list)
+		}
+	})
+}
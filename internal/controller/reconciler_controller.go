@@ -18,44 +18,104 @@ package controller
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
-	"github.com/dpeckett/ytt-operator/api/v1alpha1"
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
 	appsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// ReconcilerReconciler reconciles a Reconciler object
+// Names used by the webhook server in the operators pod spec.
+const (
+	webhookCertVolume = "cert"
+	webhookServerPort = "webhook-server"
+)
+
+// reconcilerObject is implemented by Reconcilers and ClusterReconcilers.
+type reconcilerObject interface {
+	client.Object
+	GetReconcilerSpec() *v1beta1.ReconcilerSpec
+	GetReconcilerStatus() *v1beta1.ReconcilerStatus
+	GetWatchedNamespaces() []string
+}
+
+// ReconcilerReconciler reconciles a Reconciler (or ClusterReconciler) object
 type ReconcilerReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
-	Parent *corev1.Pod
+	Scheme    *runtime.Scheme
+	Parent    *corev1.Pod
+	recorder  record.EventRecorder
+	mapper    meta.RESTMapper
+	newObject func() reconcilerObject
 }
 
+// drainPollInterval is how often we check on the progress of a draining reconciler.
+const drainPollInterval = 5 * time.Second
+
 //+kubebuilder:rbac:groups=ytt-operator.pecke.tt,resources=reconcilers,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=ytt-operator.pecke.tt,resources=reconcilers/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=ytt-operator.pecke.tt,resources=reconcilers/finalizers,verbs=update
+//+kubebuilder:rbac:groups=ytt-operator.pecke.tt,resources=clusterreconcilers,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=ytt-operator.pecke.tt,resources=clusterreconcilers/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=ytt-operator.pecke.tt,resources=clusterreconcilers/finalizers,verbs=update
 
 // So we can manage the child reconcilers.
 //+kubebuilder:rbac:groups="",resources=pods,verbs=get
 //+kubebuilder:rbac:groups="",resources=pods/status,verbs=get
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=apps,resources=deployments/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 func NewReconcilerReconciler(mgr ctrl.Manager, parent *corev1.Pod) *ReconcilerReconciler {
 	return &ReconcilerReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		Parent: parent,
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		Parent:    parent,
+		recorder:  mgr.GetEventRecorderFor("ytt-operator"),
+		mapper:    mgr.GetRESTMapper(),
+		newObject: func() reconcilerObject { return &v1beta1.Reconciler{} },
+	}
+}
+
+func NewClusterReconcilerReconciler(mgr ctrl.Manager, parent *corev1.Pod) *ReconcilerReconciler {
+	r := NewReconcilerReconciler(mgr, parent)
+	r.newObject = func() reconcilerObject { return &v1beta1.ClusterReconciler{} }
+
+	return r
+}
+
+// childKey returns the name and namespace of a reconcilers child deployment.
+// Cluster reconcilers get a prefix so they can't clash with a namespaced one.
+func childKey(obj reconcilerObject) types.NamespacedName {
+	if cluster, ok := obj.(*v1beta1.ClusterReconciler); ok {
+		return types.NamespacedName{Name: "ytt-operator-cluster-" + cluster.GetName(), Namespace: cluster.Spec.Namespace}
+	}
+
+	return types.NamespacedName{Name: "ytt-operator-" + obj.GetName(), Namespace: obj.GetNamespace()}
+}
+
+// childArg returns the argument that tells a child which reconciler it runs.
+func childArg(obj reconcilerObject) string {
+	if _, ok := obj.(*v1beta1.ClusterReconciler); ok {
+		return "--cluster-reconciler-name=" + obj.GetName()
 	}
+
+	return "--reconciler-name=" + obj.GetName()
 }
 
 func (r *ReconcilerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -63,8 +123,8 @@ func (r *ReconcilerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	logger.Info("Reconciling")
 
-	var obj v1alpha1.Reconciler
-	err := r.Get(ctx, req.NamespacedName, &obj)
+	obj := r.newObject()
+	err := r.Get(ctx, req.NamespacedName, obj)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			logger.Info("Object not found")
@@ -76,12 +136,29 @@ func (r *ReconcilerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	}
 
 	if obj.GetDeletionTimestamp() != nil {
+		// The child is responsible for releasing the objects it manages, so
+		// it needs to stay around until it has done so (even when observing,
+		// it may have claimed objects before switching mode).
+		if obj.GetAnnotations()[forceFinalizeAnnotation] != "true" {
+			drained, err := r.childDrained(ctx, obj)
+			if err != nil {
+				return ctrl.Result{}, fmt.Errorf("failed to check child reconciler: %w", err)
+			}
+
+			if !drained {
+				logger.Info("Waiting for managed objects to be released")
+
+				return ctrl.Result{RequeueAfter: drainPollInterval}, nil
+			}
+		}
+
 		logger.Info("Deleting child reconciler")
 
+		key := childKey(obj)
 		err := r.Client.Delete(ctx, &appsv1.Deployment{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:      "ytt-operator-" + obj.GetName(),
-				Namespace: obj.GetNamespace(),
+				Name:      key.Name,
+				Namespace: key.Namespace,
 			},
 		})
 		if err != nil {
@@ -90,9 +167,13 @@ func (r *ReconcilerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			}
 		}
 
+		if err := r.deleteRBAC(ctx, obj, nil); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to delete generated rbac: %w", err)
+		}
+
 		logger.Info("Removing finalizer")
 
-		if err := removeFinalizer(ctx, r.Client, &obj); err != nil {
+		if err := removeFinalizer(ctx, r.Client, obj); err != nil {
 			return ctrl.Result{}, fmt.Errorf("failed to remove finalizer: %w", err)
 		}
 
@@ -100,20 +181,47 @@ func (r *ReconcilerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	}
 
 	// Add finalizer if it's not already present.
-	if err := addFinalizer(ctx, r.Client, &obj); err != nil {
+	if err := addFinalizer(ctx, r.Client, obj); err != nil {
 		return ctrl.Result{}, fmt.Errorf("failed to add finalizer: %w", err)
 	}
 
 	logger.Info("Reconciling child reconciler")
 
-	child := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "ytt-operator-" + obj.GetName(), Namespace: obj.GetNamespace()}}
+	// The child reads its configuration on startup, so we roll it whenever the spec changes.
+	spec := obj.GetReconcilerSpec()
+
+	specHash, err := hashSpec(spec)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to hash spec: %w", err)
+	}
+
+	established, err := r.reconcileCRDs(ctx, obj)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to reconcile crds: %w", err)
+	}
+
+	// Give defined kinds a chance to be installed before starting the child.
+	if !established {
+		logger.Info("Waiting for custom resource definitions to be established")
+
+		return ctrl.Result{RequeueAfter: crdEstablishPollInterval}, nil
+	}
+
+	pending, err := r.reconcileRBAC(ctx, obj)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to reconcile rbac: %w", err)
+	}
+
+	key := childKey(obj)
+	child := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
 	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, child, func() error {
 		podSpec := r.Parent.Spec.DeepCopy()
-		podSpec.ServiceAccountName = obj.Spec.ServiceAccountName
+		podSpec.ServiceAccountName = serviceAccountName(obj)
+		removeWebhookServer(podSpec)
 
 		for i, c := range podSpec.Containers {
 			if c.Name == "manager" {
-				podSpec.Containers[i].Args = append(podSpec.Containers[i].Args, "--reconciler-name="+obj.GetName())
+				podSpec.Containers[i].Args = append(podSpec.Containers[i].Args, childArg(obj))
 				break
 			}
 		}
@@ -123,13 +231,16 @@ func (r *ReconcilerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			Replicas: &replicas,
 			Selector: &metav1.LabelSelector{
 				MatchLabels: map[string]string{
-					"app": "ytt-operator-" + obj.GetName(),
+					"app": key.Name,
 				},
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: map[string]string{
-						"app": "ytt-operator-" + obj.GetName(),
+						"app": key.Name,
+					},
+					Annotations: map[string]string{
+						specHashAnnotation: specHash,
 					},
 				},
 				Spec: *podSpec,
@@ -142,11 +253,143 @@ func (r *ReconcilerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, fmt.Errorf("failed to patch child reconciler: %w", err)
 	}
 
+	if err := r.updateSuspendedCondition(ctx, obj); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to update status: %w", err)
+	}
+
+	if err := r.clearPendingChanges(ctx, obj); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to update status: %w", err)
+	}
+
+	// The child will start reconciling kinds once they are installed, but it
+	// won't be allowed to until we've granted it access.
+	if len(pending) > 0 {
+		logger.Info("Waiting for kinds to be installed", "pending", pending)
+
+		return ctrl.Result{RequeueAfter: discoveryPollInterval}, nil
+	}
+
 	return ctrl.Result{}, nil
 }
 
+// updateSuspendedCondition reflects spec.suspend in the reconcilers status.
+func (r *ReconcilerReconciler) updateSuspendedCondition(ctx context.Context, obj reconcilerObject) error {
+	spec, status := obj.GetReconcilerSpec(), obj.GetReconcilerStatus()
+
+	cond := metav1.Condition{
+		Type:    "Suspended",
+		Status:  metav1.ConditionFalse,
+		Reason:  "Resumed",
+		Message: "Reconciler is active",
+	}
+
+	if spec.Suspend {
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = "Suspended"
+		cond.Message = "Reconciler is suspended, no resources will be rendered, deployed or deleted"
+	}
+
+	existing := meta.FindStatusCondition(status.Conditions, cond.Type)
+	if existing != nil && existing.Status == cond.Status {
+		return nil
+	}
+
+	// Don't bother reporting that a reconciler that was never suspended is active.
+	if existing == nil && !spec.Suspend {
+		return nil
+	}
+
+	eventType := corev1.EventTypeNormal
+	if spec.Suspend {
+		eventType = corev1.EventTypeWarning
+	}
+	r.recorder.Event(obj, eventType, cond.Reason, cond.Message)
+
+	clone := obj.DeepCopyObject().(reconcilerObject)
+	cond.ObservedGeneration = obj.GetGeneration()
+	meta.SetStatusCondition(&clone.GetReconcilerStatus().Conditions, cond)
+
+	return r.Status().Patch(ctx, clone, client.MergeFrom(obj))
+}
+
+// clearPendingChanges removes the pending changes reported by the child once
+// the reconciler is no longer in the Observe mode.
+func (r *ReconcilerReconciler) clearPendingChanges(ctx context.Context, obj reconcilerObject) error {
+	if obj.GetReconcilerSpec().Mode == v1beta1.ReconcilerModeObserve || len(obj.GetReconcilerStatus().PendingChanges) == 0 {
+		return nil
+	}
+
+	clone := obj.DeepCopyObject().(reconcilerObject)
+	clone.GetReconcilerStatus().PendingChanges = nil
+
+	return r.Status().Patch(ctx, clone, client.MergeFrom(obj))
+}
+
+// childDrained returns true once the child has reported that it released
+// all of its managed objects, or if there is no child left to do so.
+func (r *ReconcilerReconciler) childDrained(ctx context.Context, obj reconcilerObject) (bool, error) {
+	cond := meta.FindStatusCondition(obj.GetReconcilerStatus().Conditions, conditionDraining)
+	if cond != nil && cond.Status == metav1.ConditionFalse && cond.Reason == reasonDrained {
+		return true, nil
+	}
+
+	var child appsv1.Deployment
+	if err := r.Get(ctx, childKey(obj), &child); err != nil {
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+
+		return false, err
+	}
+
+	return false, nil
+}
+
+func hashSpec(spec *v1beta1.ReconcilerSpec) (string, error) {
+	specJSON, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(specJSON)
+	return hex.EncodeToString(sum[:]), nil
+}
+
 func (r *ReconcilerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&v1alpha1.Reconciler{}).
+		For(r.newObject()).
 		Complete(r)
 }
+
+// removeWebhookServer strips the webhook serving certificate (which only
+// exists in the operators namespace) from a copy of the parents pod spec,
+// children don't serve webhooks.
+func removeWebhookServer(podSpec *corev1.PodSpec) {
+	var volumes []corev1.Volume
+	for _, v := range podSpec.Volumes {
+		if v.Name != webhookCertVolume {
+			volumes = append(volumes, v)
+		}
+	}
+	podSpec.Volumes = volumes
+
+	for i := range podSpec.Containers {
+		c := &podSpec.Containers[i]
+
+		var mounts []corev1.VolumeMount
+		for _, m := range c.VolumeMounts {
+			if m.Name != webhookCertVolume {
+				mounts = append(mounts, m)
+			}
+		}
+		c.VolumeMounts = mounts
+
+		var ports []corev1.ContainerPort
+		for _, p := range c.Ports {
+			if p.Name != webhookServerPort {
+				ports = append(ports, p)
+			}
+		}
+		c.Ports = ports
+	}
+}
@@ -18,13 +18,12 @@ package controller_test
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
 	"os"
 	"testing"
 	"time"
 
-	"github.com/dpeckett/ytt-operator/api/v1alpha1"
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
 	"github.com/dpeckett/ytt-operator/internal/controller"
 	"github.com/go-logr/zapr"
 	"github.com/stretchr/testify/assert"
@@ -84,7 +83,7 @@ func TestReconcilerReconciler(t *testing.T) {
 
 	scheme := runtime.NewScheme()
 	require.NoError(t, appsv1.AddToScheme(scheme))
-	require.NoError(t, v1alpha1.AddToScheme(scheme))
+	require.NoError(t, v1beta1.AddToScheme(scheme))
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
@@ -118,23 +117,23 @@ func TestReconcilerReconciler(t *testing.T) {
 	}()
 
 	t.Run("Test child reconciler creation", func(t *testing.T) {
-		obj := &v1alpha1.Reconciler{
+		obj := &v1beta1.Reconciler{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      "test",
 				Namespace: "default",
 			},
-			Spec: v1alpha1.ReconcilerSpec{
+			Spec: v1beta1.ReconcilerSpec{
 				ServiceAccountName: "default",
-				For: []metav1.TypeMeta{
+				For: []v1beta1.ReconcilerForSpec{
 					{
 						Kind:       "Deployment",
 						APIVersion: "apps/v1",
 					},
 				},
-				Scripts: []v1alpha1.ReconcilerScriptSpec{
+				Scripts: []v1beta1.ReconcilerScriptSpec{
 					{
 						Name:    "test.yaml",
-						Encoded: base64.StdEncoding.EncodeToString([]byte("foo: bar")),
+						Content: "foo: bar",
 					},
 				},
 			},
@@ -0,0 +1,236 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	"github.com/dpeckett/ytt-operator/internal/util"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Reasons a deploy can be blocked.
+const (
+	reasonBlocked        = "Blocked"
+	reasonEmptyRender    = "EmptyRender"
+	reasonTooManyDeletes = "TooManyDeletes"
+	reasonNeedsApproval  = "ApprovalRequired"
+)
+
+// safetyCheck is the outcome of checking a render against the safety limits.
+type safetyCheck struct {
+	// empty is true if the render produced no resources.
+	empty bool
+	// reason and message are set if the deploy would violate a limit.
+	reason  string
+	message string
+	plan    *util.KappPlan
+}
+
+// checkSafety works out whether deploying a render would delete more
+// resources than the reconciler allows, or needs to be approved first. Kapp
+// treats an empty render as a request to delete everything, which is almost
+// always a template bug.
+func (r *YTTReconciler) checkSafety(ctx context.Context, obj *unstructured.Unstructured, out []byte) (*safetyCheck, error) {
+	docs, err := util.SplitManifests(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rendered manifests: %w", err)
+	}
+
+	safety := r.safety()
+	check := &safetyCheck{empty: len(docs) == 0}
+
+	if check.empty && !safety.AllowEmptyRender {
+		check.reason = reasonEmptyRender
+		check.message = "Render produced no resources"
+	} else if safety.MaxDeletePercent == nil && safety.MaxDeleteCount == nil && r.spec.Approval == nil {
+		return check, nil
+	}
+
+	check.plan, err = r.plan(ctx, obj, out, check.empty)
+	if err != nil {
+		return nil, err
+	}
+
+	deletes := len(check.plan.Filter(util.KappOpDelete))
+	if check.reason != "" {
+		// Nothing would be lost if the app doesn't have any resources yet.
+		if deletes == 0 {
+			check.reason, check.message = "", ""
+		}
+
+		return check, nil
+	}
+
+	if safety.MaxDeleteCount != nil && deletes > int(*safety.MaxDeleteCount) {
+		check.reason = reasonTooManyDeletes
+		check.message = fmt.Sprintf("Deploy would delete %d resources, more than the limit of %d", deletes, *safety.MaxDeleteCount)
+
+		return check, nil
+	}
+
+	if safety.MaxDeletePercent != nil && deletes > 0 {
+		existing, err := r.existingResources(ctx, obj)
+		if err != nil {
+			return nil, err
+		}
+
+		if existing > 0 && deletes*100 > int(*safety.MaxDeletePercent)*existing {
+			check.reason = reasonTooManyDeletes
+			check.message = fmt.Sprintf("Deploy would delete %d of %d resources, more than the limit of %d%%",
+				deletes, existing, *safety.MaxDeletePercent)
+
+			return check, nil
+		}
+	}
+
+	if matched := needsApproval(r.spec.Approval, check.plan); len(matched) > 0 {
+		check.reason = reasonNeedsApproval
+		check.message = fmt.Sprintf("Deploy requires approval, %d changes match the approval policy", len(matched))
+	}
+
+	return check, nil
+}
+
+// needsApproval returns the changes in a plan that match an approval policy.
+func needsApproval(approval *v1beta1.ReconcilerApprovalSpec, plan *util.KappPlan) []util.KappChange {
+	if approval == nil {
+		return nil
+	}
+
+	kinds := make(map[string]bool, len(approval.Kinds))
+	for _, kind := range approval.Kinds {
+		kinds[kind] = true
+	}
+
+	var matched []util.KappChange
+	for _, c := range plan.Changes {
+		// Kapp reports replacements as an op strategy of "replace" or
+		// "fallback on replace".
+		replace := strings.Contains(c.OpStrategy, "replace")
+
+		if (approval.Deletes && c.Op == util.KappOpDelete) || (approval.Replacements && replace) || kinds[c.Kind] {
+			matched = append(matched, c)
+		}
+	}
+
+	return matched
+}
+
+// blocked reports a deploy that has been stopped by the safety limits. It is
+// not retried until either the object or its approval annotation changes.
+func (r *YTTReconciler) blocked(ctx context.Context, obj *unstructured.Unstructured, check *safetyCheck) error {
+	logger := log.FromContext(ctx)
+
+	message := fmt.Sprintf("%s: %s (set the %s annotation to %q to approve)",
+		check.message, check.plan.Summary(), approvedPlanAnnotation, check.plan.Hash())
+
+	logger.Info("Deploy blocked", "reason", check.reason, "plan", check.plan.Hash())
+
+	r.recorder.Event(obj, corev1.EventTypeWarning, reasonBlocked, message)
+
+	_, err := setCondition(ctx, r.Client, obj, metav1.Condition{
+		Type:    conditionBlocked,
+		Status:  metav1.ConditionTrue,
+		Reason:  check.reason,
+		Message: message,
+	}, false)
+
+	return err
+}
+
+// plan asks kapp which changes it would make to deploy a render.
+func (r *YTTReconciler) plan(ctx context.Context, obj *unstructured.Unstructured, out []byte, allowEmpty bool) (*util.KappPlan, error) {
+	logger := log.FromContext(ctx)
+
+	// The diff is needed so that approvals cover what changes, and not just
+	// which resources do.
+	args := []string{"deploy", "-a", r.appName(obj), "-f", "-", "--diff-run", "--diff-changes", "--json"}
+	if allowEmpty {
+		args = append(args, "--dangerous-allow-empty-list-of-resources")
+	}
+
+	_, redaction := r.redactor.Redact(out)
+
+	var outBuf bytes.Buffer
+	cmd := exec.Command("kapp", args...)
+	cmd.Stdin = bytes.NewReader(out)
+	cmd.Stdout = &outBuf
+	cmd.Stderr = util.NewKappLogInterceptor(logger, true, redaction)
+
+	if err := r.run(ctx, cmd, durationOf(r.timeouts().Plan)); err != nil {
+		r.recordFailure(obj, reasonPlanFailed, fmt.Errorf("kapp diff failed: %w", err))
+
+		return nil, fmt.Errorf("kapp diff failed: %w", err)
+	}
+
+	return util.ParseKappPlan(outBuf.Bytes())
+}
+
+// existingResources returns the number of resources currently owned by an objects app.
+func (r *YTTReconciler) existingResources(ctx context.Context, obj *unstructured.Unstructured) (int, error) {
+	logger := log.FromContext(ctx)
+
+	var outBuf bytes.Buffer
+	cmd := exec.Command("kapp", "inspect", "-a", r.appName(obj), "--json")
+	cmd.Stdout = &outBuf
+	cmd.Stderr = util.NewKappLogInterceptor(logger, true, nil)
+
+	if err := r.run(ctx, cmd, durationOf(r.timeouts().Plan)); err != nil {
+		r.recordFailure(obj, reasonPlanFailed, fmt.Errorf("kapp inspect failed: %w", err))
+
+		return 0, fmt.Errorf("kapp inspect failed: %w", err)
+	}
+
+	return util.CountKappResources(outBuf.Bytes())
+}
+
+// clearApproval removes the approved plan annotation from an object, an
+// approval only applies to a single deploy.
+func (r *YTTReconciler) clearApproval(ctx context.Context, obj *unstructured.Unstructured) error {
+	if _, ok := obj.GetAnnotations()[approvedPlanAnnotation]; !ok {
+		return nil
+	}
+
+	clone := obj.DeepCopy()
+	annotations := clone.GetAnnotations()
+	delete(annotations, approvedPlanAnnotation)
+	clone.SetAnnotations(annotations)
+
+	if err := r.Patch(ctx, clone, client.MergeFrom(obj)); err != nil {
+		return fmt.Errorf("failed to remove approval: %w", err)
+	}
+
+	return nil
+}
+
+func (r *YTTReconciler) safety() *v1beta1.ReconcilerSafetySpec {
+	if r.spec.Safety == nil {
+		return &v1beta1.ReconcilerSafetySpec{}
+	}
+
+	return r.spec.Safety
+}
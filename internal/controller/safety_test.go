@@ -0,0 +1,83 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	"github.com/dpeckett/ytt-operator/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestNeedsApproval(t *testing.T) {
+	plan := &util.KappPlan{Changes: []util.KappChange{
+		{Namespace: "default", Name: "data", Kind: "PersistentVolumeClaim", Op: util.KappOpCreate},
+		{Namespace: "default", Name: "old", Kind: "ConfigMap", Op: util.KappOpDelete},
+		{Namespace: "default", Name: "migrate", Kind: "Job", Op: util.KappOpUpdate, OpStrategy: "fallback on replace"},
+		{Namespace: "default", Name: "web", Kind: "Deployment", Op: util.KappOpUpdate},
+	}}
+
+	assert.Empty(t, needsApproval(nil, plan))
+
+	assert.Equal(t, []util.KappChange{plan.Changes[1]},
+		needsApproval(&v1beta1.ReconcilerApprovalSpec{Deletes: true}, plan))
+
+	assert.Equal(t, []util.KappChange{plan.Changes[2]},
+		needsApproval(&v1beta1.ReconcilerApprovalSpec{Replacements: true}, plan))
+
+	assert.Equal(t, []util.KappChange{plan.Changes[0]},
+		needsApproval(&v1beta1.ReconcilerApprovalSpec{Kinds: []string{"PersistentVolumeClaim"}}, plan))
+
+	assert.Empty(t, needsApproval(&v1beta1.ReconcilerApprovalSpec{Deletes: true, Kinds: []string{"Secret"}},
+		&util.KappPlan{Changes: plan.Changes[3:]}), "Plain updates shouldn't need approval")
+}
+
+func TestClearApproval(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name:        "approved",
+		Namespace:   "default",
+		Annotations: map[string]string{approvedPlanAnnotation: "0123456789abcdef", "other": "kept"},
+	}}).Build()
+
+	r := &YTTReconciler{Client: c}
+
+	ctx := context.Background()
+	key := client.ObjectKey{Name: "approved", Namespace: "default"}
+
+	var obj unstructured.Unstructured
+	obj.SetAPIVersion("v1")
+	obj.SetKind("ConfigMap")
+	require.NoError(t, c.Get(ctx, key, &obj))
+
+	require.NoError(t, r.clearApproval(ctx, &obj))
+
+	var cm corev1.ConfigMap
+	require.NoError(t, c.Get(ctx, key, &cm))
+	assert.Equal(t, map[string]string{"other": "kept"}, cm.Annotations, "Approvals should only apply to a single deploy")
+}
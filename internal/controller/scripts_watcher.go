@@ -0,0 +1,158 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// scriptsChangeDebounce is how long to wait for a directory to settle after a
+// change (editors often write a file in several steps).
+const scriptsChangeDebounce = 250 * time.Millisecond
+
+// ScriptsWatcher watches a local scripts directory (in development mode), so
+// that every object can be reconciled again whenever a script changes.
+type ScriptsWatcher struct {
+	dir string
+
+	mu        sync.Mutex
+	listeners map[int]func()
+	nextID    int
+}
+
+func NewScriptsWatcher(dir string) *ScriptsWatcher {
+	return &ScriptsWatcher{dir: dir}
+}
+
+// OnChange registers a function to be called whenever the scripts change.
+// The returned function unregisters it.
+func (w *ScriptsWatcher) OnChange(fn func()) func() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.listeners == nil {
+		w.listeners = map[int]func(){}
+	}
+
+	id := w.nextID
+	w.nextID++
+	w.listeners[id] = fn
+
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		delete(w.listeners, id)
+	}
+}
+
+// Start watches the scripts directory until the context is cancelled.
+func (w *ScriptsWatcher) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("scripts-watcher")
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	// Watches aren't recursive, so each subdirectory needs one of its own.
+	if err := w.addDirs(watcher, w.dir); err != nil {
+		return err
+	}
+
+	var settled <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			// Skip editor swap files and the like.
+			if strings.HasPrefix(filepath.Base(ev.Name), ".") {
+				continue
+			}
+
+			if ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					if err := w.addDirs(watcher, ev.Name); err != nil {
+						logger.Error(err, "Failed to watch new directory", "dir", ev.Name)
+					}
+				}
+			}
+
+			settled = time.After(scriptsChangeDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+
+			logger.Error(err, "Failed to watch scripts")
+		case <-settled:
+			settled = nil
+
+			logger.Info("Scripts changed, reconciling all objects")
+
+			w.mu.Lock()
+			listeners := make([]func(), 0, len(w.listeners))
+			for _, fn := range w.listeners {
+				listeners = append(listeners, fn)
+			}
+			w.mu.Unlock()
+
+			for _, fn := range listeners {
+				fn()
+			}
+		}
+	}
+}
+
+// addDirs watches a directory and all of its (non hidden) subdirectories.
+func (w *ScriptsWatcher) addDirs(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() {
+			return nil
+		}
+
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+
+		return nil
+	})
+}
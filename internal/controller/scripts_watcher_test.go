@@ -0,0 +1,61 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScriptsWatcher(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "lib"), 0o755))
+
+	w := NewScriptsWatcher(dir)
+
+	changed := make(chan struct{}, 1)
+	w.OnChange(func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	go func() {
+		_ = w.Start(ctx)
+	}()
+
+	// Keep writing until the watch is in place.
+	require.Eventually(t, func() bool {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "lib", "helpers.star"), []byte("def name(): return \"x\"\nend\n"), 0o644))
+
+		select {
+		case <-changed:
+			return true
+		case <-time.After(2 * scriptsChangeDebounce):
+			return false
+		}
+	}, 10*time.Second, 10*time.Millisecond, "Changes in subdirectories should be noticed")
+}
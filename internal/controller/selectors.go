@@ -0,0 +1,135 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// objectSelector decides which objects a reconciler is responsible for.
+type objectSelector struct {
+	namespaces        map[string]bool
+	namespaceSelector labels.Selector
+	selector          labels.Selector
+}
+
+// newObjectSelector builds the selector for objects of the given kind, which
+// combines the reconcilers own selectors with that of the kinds binding.
+func newObjectSelector(spec *v1beta1.ReconcilerSpec, gvk schema.GroupVersionKind) (*objectSelector, error) {
+	s := &objectSelector{
+		namespaceSelector: labels.Everything(),
+		selector:          labels.Everything(),
+	}
+
+	if len(spec.Namespaces) > 0 {
+		s.namespaces = make(map[string]bool, len(spec.Namespaces))
+		for _, ns := range spec.Namespaces {
+			s.namespaces[ns] = true
+		}
+	}
+
+	var err error
+	if spec.NamespaceSelector != nil {
+		s.namespaceSelector, err = metav1.LabelSelectorAsSelector(spec.NamespaceSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace selector: %w", err)
+		}
+	}
+
+	if spec.Selector != nil {
+		s.selector, err = metav1.LabelSelectorAsSelector(spec.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector: %w", err)
+		}
+	}
+
+	for _, binding := range spec.For {
+		if binding.GroupVersionKind() != gvk || binding.Selector == nil {
+			continue
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(binding.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector for %s: %w", gvk.Kind, err)
+		}
+
+		reqs, _ := selector.Requirements()
+		s.selector = s.selector.Add(reqs...)
+	}
+
+	return s, nil
+}
+
+// hasNamespaceSelector returns true if namespace labels need to be consulted.
+func (s *objectSelector) hasNamespaceSelector() bool {
+	return !s.namespaceSelector.Empty()
+}
+
+// Matches returns true if the object should be reconciled.
+func (s *objectSelector) Matches(ctx context.Context, c client.Reader, obj client.Object) (bool, error) {
+	// Cluster scoped objects can't be restricted by namespace.
+	if s.namespaces != nil && obj.GetNamespace() != "" && !s.namespaces[obj.GetNamespace()] {
+		return false, nil
+	}
+
+	if !s.selector.Matches(labels.Set(obj.GetLabels())) {
+		return false, nil
+	}
+
+	// Cluster scoped objects have no namespace to select on.
+	if s.hasNamespaceSelector() && obj.GetNamespace() != "" {
+		var ns corev1.Namespace
+		if err := c.Get(ctx, types.NamespacedName{Name: obj.GetNamespace()}, &ns); err != nil {
+			return false, fmt.Errorf("failed to get namespace: %w", err)
+		}
+
+		if !s.namespaceSelector.Matches(labels.Set(ns.GetLabels())) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Filter is used as a controller predicate. Objects that carry our finalizer
+// are always let through so that we are able to clean up after objects that
+// have since opted out.
+func (s *objectSelector) Filter(c client.Reader) func(obj client.Object) bool {
+	return func(obj client.Object) bool {
+		if controllerutil.ContainsFinalizer(obj, finalizer) {
+			return true
+		}
+
+		ok, err := s.Matches(context.Background(), c, obj)
+		if err != nil {
+			// Let the reconciler deal with (and report) the error.
+			return true
+		}
+
+		return ok
+	}
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestObjectSelector(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"team": "a"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b", Labels: map[string]string{"team": "b"}}},
+	).Build()
+
+	newObj := func(namespace string, labels map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: namespace, Labels: labels}}
+	}
+
+	s, err := newObjectSelector(&v1beta1.ReconcilerSpec{
+		Namespaces: []string{"team-a", "team-b"},
+		NamespaceSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"team": "a"},
+		},
+		Selector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"ytt-operator.pecke.tt/enabled": "true"},
+		},
+		For: []v1beta1.ReconcilerForSpec{
+			{APIVersion: "v1", Kind: "ConfigMap", Selector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"bronze"}}},
+			}},
+			{APIVersion: "v1", Kind: "Secret", Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"tier": "gold"},
+			}},
+		},
+	}, corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	ok, err := s.Matches(ctx, c, newObj("team-a", map[string]string{"ytt-operator.pecke.tt/enabled": "true"}))
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = s.Matches(ctx, c, newObj("team-a", nil))
+	require.NoError(t, err)
+	assert.False(t, ok, "Objects without the label should not match")
+
+	ok, err = s.Matches(ctx, c, newObj("team-a", map[string]string{"ytt-operator.pecke.tt/enabled": "true", "tier": "bronze"}))
+	require.NoError(t, err)
+	assert.False(t, ok, "Objects excluded by their kinds binding should not match")
+
+	ok, err = s.Matches(ctx, c, newObj("team-b", map[string]string{"ytt-operator.pecke.tt/enabled": "true"}))
+	require.NoError(t, err)
+	assert.False(t, ok, "Namespaces with the wrong labels should not match")
+
+	ok, err = s.Matches(ctx, c, newObj("default", map[string]string{"ytt-operator.pecke.tt/enabled": "true"}))
+	require.NoError(t, err)
+	assert.False(t, ok, "Namespaces outside of the list should not match")
+
+	ok, err = s.Matches(ctx, c, newObj("", map[string]string{"ytt-operator.pecke.tt/enabled": "true"}))
+	require.NoError(t, err)
+	assert.True(t, ok, "Cluster scoped objects should not be restricted by namespace")
+
+	obj := newObj("default", nil)
+	obj.SetFinalizers([]string{finalizer})
+	assert.True(t, s.Filter(c)(obj), "Objects with a finalizer should always be let through")
+}
@@ -25,6 +25,32 @@ import (
 
 const finalizer = "ytt-operator.damian.pecke.tt"
 
+// ownerLabel records which reconciler added our finalizer to an object, the
+// finalizer is shared by every reconciler.
+const ownerLabel = "ytt-operator.pecke.tt/owner"
+
+// specHashAnnotation is set on the child pod template so that changes to a
+// reconciler spec trigger a rollout.
+const specHashAnnotation = "ytt-operator.pecke.tt/spec-hash"
+
+// pausedAnnotation can be set to "true" on an object to stop the operator
+// from touching its resources.
+const pausedAnnotation = "ytt-operator.pecke.tt/paused"
+
+// deletionPolicyAnnotation overrides the reconcilers deletion policy for an object.
+const deletionPolicyAnnotation = "ytt-operator.pecke.tt/deletion-policy"
+
+// forceFinalizeAnnotation can be set to "true" on an object that is being
+// deleted to remove our finalizer without cleaning up its resources.
+const forceFinalizeAnnotation = "ytt-operator.pecke.tt/force-finalize"
+
+// approvedPlanAnnotation approves a blocked deploy, its value must be the
+// hash of the plan reported in the Blocked condition.
+const approvedPlanAnnotation = "ytt-operator.pecke.tt/approved-plan"
+
+// kappDeleteStrategyAnnotation controls how kapp deletes a resource.
+const kappDeleteStrategyAnnotation = "kapp.k14s.io/delete-strategy"
+
 func addFinalizer(ctx context.Context, c client.Client, obj client.Object) error {
 	if controllerutil.ContainsFinalizer(obj, finalizer) {
 		// finalizer already present, nothing to do
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Condition types set on reconciled objects.
+const (
+	conditionPaused          = "Paused"
+	conditionDeletionBlocked = "DeletionBlocked"
+	conditionBlocked         = "Blocked"
+	conditionPendingChanges  = "PendingChanges"
+)
+
+// getConditions returns the conditions from an objects status.
+func getConditions(obj *unstructured.Unstructured) ([]metav1.Condition, error) {
+	raw, found, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if err != nil || !found {
+		return nil, err
+	}
+
+	conditions := make([]metav1.Condition, 0, len(raw))
+	for _, item := range raw {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		var cond metav1.Condition
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m, &cond); err != nil {
+			return nil, err
+		}
+
+		conditions = append(conditions, cond)
+	}
+
+	return conditions, nil
+}
+
+// setCondition sets (or with remove, removes) a condition on the status of an
+// object. We only touch the status of custom resources as built-in kinds have
+// their own condition schemas. Objects without a status subresource are
+// silently ignored. Returns true if the condition was changed, as read back
+// after the patch (schemas without status.conditions prune it).
+func setCondition(ctx context.Context, c client.Client, obj *unstructured.Unstructured, cond metav1.Condition, remove bool) (bool, error) {
+	if isBuiltinGroup(obj.GroupVersionKind().Group) {
+		return false, nil
+	}
+
+	conditions, err := getConditions(obj)
+	if err != nil {
+		return false, fmt.Errorf("failed to get conditions: %w", err)
+	}
+
+	existing := meta.FindStatusCondition(conditions, cond.Type)
+	if remove {
+		if existing == nil {
+			return false, nil
+		}
+
+		meta.RemoveStatusCondition(&conditions, cond.Type)
+	} else {
+		if existing != nil && existing.Status == cond.Status &&
+			existing.Reason == cond.Reason && existing.Message == cond.Message {
+			return false, nil
+		}
+
+		cond.ObservedGeneration = obj.GetGeneration()
+		meta.SetStatusCondition(&conditions, cond)
+	}
+
+	raw := make([]interface{}, 0, len(conditions))
+	for i := range conditions {
+		m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&conditions[i])
+		if err != nil {
+			return false, fmt.Errorf("failed to convert condition: %w", err)
+		}
+
+		raw = append(raw, m)
+	}
+
+	clone := obj.DeepCopy()
+	if err := unstructured.SetNestedSlice(clone.Object, raw, "status", "conditions"); err != nil {
+		return false, fmt.Errorf("failed to set conditions: %w", err)
+	}
+
+	if err := c.Status().Patch(ctx, clone, client.MergeFrom(obj)); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("failed to patch status: %w", err)
+	}
+
+	obj.Object = clone.Object
+
+	stored, err := getConditions(obj)
+	if err != nil {
+		return false, fmt.Errorf("failed to get conditions: %w", err)
+	}
+
+	return (meta.FindStatusCondition(stored, cond.Type) == nil) == remove, nil
+}
+
+// isBuiltinGroup returns true if the API group belongs to Kubernetes itself.
+func isBuiltinGroup(group string) bool {
+	return !strings.Contains(group, ".") || strings.HasSuffix(group, ".k8s.io")
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dpeckett/ytt-operator/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSetCondition(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+
+	ctx := context.Background()
+	cond := metav1.Condition{
+		Type:    conditionPaused,
+		Status:  metav1.ConditionTrue,
+		Reason:  reasonPaused,
+		Message: "Paused by annotation",
+	}
+
+	newClient := func() (client.Client, *unstructured.Unstructured) {
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&v1alpha1.TestResource{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+		}).Build()
+
+		var obj unstructured.Unstructured
+		obj.SetGroupVersionKind(v1alpha1.GroupVersion.WithKind("TestResource"))
+		require.NoError(t, c.Get(ctx, client.ObjectKey{Name: "test", Namespace: "default"}, &obj))
+
+		return c, &obj
+	}
+
+	t.Run("Stored", func(t *testing.T) {
+		c, obj := newClient()
+
+		changed, err := setCondition(ctx, c, obj, cond, false)
+		require.NoError(t, err)
+		assert.True(t, changed)
+
+		changed, err = setCondition(ctx, c, obj, cond, false)
+		require.NoError(t, err)
+		assert.False(t, changed)
+
+		changed, err = setCondition(ctx, c, obj, metav1.Condition{Type: conditionPaused}, true)
+		require.NoError(t, err)
+		assert.True(t, changed)
+	})
+
+	t.Run("Pruned", func(t *testing.T) {
+		c, obj := newClient()
+		c = &pruningClient{Client: c}
+
+		for i := 0; i < 2; i++ {
+			changed, err := setCondition(ctx, c, obj, cond, false)
+			require.NoError(t, err)
+			assert.False(t, changed, "A pruned condition shouldn't be reported as changed")
+		}
+	})
+}
+
+// pruningClient behaves like the API server for a schema that doesn't
+// include status.conditions.
+type pruningClient struct {
+	client.Client
+}
+
+func (c *pruningClient) Status() client.StatusWriter {
+	return &pruningStatusWriter{StatusWriter: c.Client.Status()}
+}
+
+type pruningStatusWriter struct {
+	client.StatusWriter
+}
+
+func (w *pruningStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		unstructured.RemoveNestedField(u.Object, "status", "conditions")
+	}
+
+	return w.StatusWriter.Patch(ctx, obj, patch, opts...)
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// migrationRetryInterval is how long to wait before retrying a failed migration.
+const migrationRetryInterval = 30 * time.Second
+
+// reconcilersCRDName is the name of the Reconciler CustomResourceDefinition.
+const reconcilersCRDName = "reconcilers.ytt-operator.pecke.tt"
+
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get,resourceNames=reconcilers.ytt-operator.pecke.tt
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions/status,verbs=update;patch,resourceNames=reconcilers.ytt-operator.pecke.tt
+
+// StorageVersionMigrator rewrites every Reconciler so that it is stored as
+// the current storage version, and then drops the old versions from the
+// CRDs stored versions (so that they can eventually stop being served).
+type StorageVersionMigrator struct {
+	client    client.Client
+	apiReader client.Reader
+}
+
+var _ manager.LeaderElectionRunnable = &StorageVersionMigrator{}
+
+func NewStorageVersionMigrator(mgr ctrl.Manager) *StorageVersionMigrator {
+	return &StorageVersionMigrator{
+		client:    mgr.GetClient(),
+		apiReader: mgr.GetAPIReader(),
+	}
+}
+
+func (m *StorageVersionMigrator) SetupWithManager(mgr ctrl.Manager) error {
+	return mgr.Add(m)
+}
+
+func (m *StorageVersionMigrator) NeedLeaderElection() bool {
+	return true
+}
+
+// Start runs the migration, retrying until it succeeds.
+func (m *StorageVersionMigrator) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("storage-version-migrator")
+
+	err := wait.PollImmediateUntilWithContext(ctx, migrationRetryInterval, func(ctx context.Context) (bool, error) {
+		if err := m.migrate(ctx); err != nil {
+			logger.Error(err, "Storage version migration failed, will retry")
+
+			return false, nil
+		}
+
+		return true, nil
+	})
+	if err != nil && ctx.Err() == nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *StorageVersionMigrator) migrate(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("storage-version-migrator")
+
+	var crd apiextensionsv1.CustomResourceDefinition
+	if err := m.apiReader.Get(ctx, client.ObjectKey{Name: reconcilersCRDName}, &crd); err != nil {
+		return fmt.Errorf("failed to get crd: %w", err)
+	}
+
+	storageVersion := v1beta1.GroupVersion.Version
+	if len(crd.Status.StoredVersions) == 1 && crd.Status.StoredVersions[0] == storageVersion {
+		return nil
+	}
+
+	logger.Info("Migrating reconcilers to the current storage version",
+		"storedVersions", crd.Status.StoredVersions, "storageVersion", storageVersion)
+
+	var list v1beta1.ReconcilerList
+	if err := m.apiReader.List(ctx, &list); err != nil {
+		return fmt.Errorf("failed to list reconcilers: %w", err)
+	}
+
+	for i := range list.Items {
+		// An unchanged update is enough to have the object re-encoded in the
+		// storage version. A conflict means somebody else beat us to it.
+		if err := m.client.Update(ctx, &list.Items[i]); err != nil && !errors.IsConflict(err) && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to migrate reconciler %s: %w", client.ObjectKeyFromObject(&list.Items[i]), err)
+		}
+	}
+
+	patch := client.MergeFrom(crd.DeepCopy())
+	crd.Status.StoredVersions = []string{storageVersion}
+	if err := m.client.Status().Patch(ctx, &crd, patch); err != nil {
+		return fmt.Errorf("failed to update stored versions: %w", err)
+	}
+
+	logger.Info("Storage version migration complete", "migrated", len(list.Items))
+
+	return nil
+}
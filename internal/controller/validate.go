@@ -0,0 +1,177 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/dpeckett/ytt-operator/internal/util"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// reasonInvalidManifests is the event reason for renders rejected by the API server.
+const reasonInvalidManifests = "InvalidManifests"
+
+// kappConfigGroup is the API group of kapps own configuration, which can be
+// included in a render but is never sent to the API server.
+const kappConfigGroup = "kapp.k14s.io"
+
+// fieldPatterns extract field paths from API server decoding errors (eg.
+// `unknown field "spec.foo"`).
+var fieldPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?:unknown|duplicate) field "([^"]+)"`),
+	regexp.MustCompile(`Go struct field \w+\.(\S+) of type`),
+}
+
+// validate checks every rendered document with a dry run create, rejecting
+// unknown fields, so that a template bug fails the deploy before kapp has
+// changed anything. Errors other than validation failures (eg. kinds or
+// namespaces created by the same deploy, or objects that already exist) are
+// left for kapp to deal with.
+func (r *YTTReconciler) validate(ctx context.Context, obj *unstructured.Unstructured, out []byte) error {
+	logger := log.FromContext(ctx)
+
+	docs, err := util.DecodeManifests(bytes.NewReader(out))
+	if err != nil {
+		return fmt.Errorf("failed to parse rendered manifests: %w", err)
+	}
+
+	// API server errors can quote field values.
+	_, redaction := r.redactor.Redact(out)
+
+	var problems []string
+	for _, doc := range docs {
+		gvk := doc.GroupVersionKind()
+		if gvk.Group == kappConfigGroup {
+			continue
+		}
+
+		mapping, err := r.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+
+			return fmt.Errorf("failed to get mapping for %s: %w", gvk.String(), err)
+		}
+
+		// Kapp deploys namespaced resources without a namespace to its own.
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace && doc.GetNamespace() == "" {
+			doc.SetNamespace(r.namespace)
+		}
+
+		name := resourceName(doc)
+
+		err = r.Create(ctx, doc, client.DryRunAll, &client.CreateOptions{
+			Raw: &metav1.CreateOptions{FieldValidation: metav1.FieldValidationStrict},
+		})
+		if err == nil || !(errors.IsInvalid(err) || errors.IsBadRequest(err)) {
+			if err != nil && !errors.IsAlreadyExists(err) {
+				logger.Info("Unable to validate resource, leaving it to kapp", "resource", name, "error", redaction.String(err.Error()))
+			}
+
+			continue
+		}
+
+		problem := name + ": " + redaction.String(err.Error())
+
+		for _, field := range invalidFields(err) {
+			locations, err := util.LocateField(r.scriptsDir, field)
+			if err != nil {
+				return err
+			}
+
+			if len(locations) > 0 {
+				problem += fmt.Sprintf(" (%s may be set at %s)", field, strings.Join(locations, ", "))
+			}
+		}
+
+		problems = append(problems, problem)
+	}
+
+	if len(problems) > 0 {
+		err := fmt.Errorf("rendered manifests are invalid: %s", strings.Join(problems, "; "))
+
+		logger.Error(err, "Validation failed")
+		r.recordFailure(obj, reasonInvalidManifests, err)
+
+		return err
+	}
+
+	return nil
+}
+
+// invalidFields returns the paths of the fields an API server error refers to.
+func invalidFields(err error) []string {
+	var fields []string
+	seen := make(map[string]bool)
+	add := func(field string) {
+		field = strings.TrimPrefix(field, ".")
+		if field != "" && !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+
+	var statusErr *errors.StatusError
+	if stderrors.As(err, &statusErr) && statusErr.ErrStatus.Details != nil {
+		for _, cause := range statusErr.ErrStatus.Details.Causes {
+			add(cause.Field)
+		}
+	}
+
+	for _, pattern := range fieldPatterns {
+		for _, match := range pattern.FindAllStringSubmatch(err.Error(), -1) {
+			add(match[1])
+		}
+	}
+
+	return fields
+}
+
+// resourceName describes a resource in the same way as kapp (eg. Deployment/default/web).
+func resourceName(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetKind() + "/" + obj.GetName()
+	}
+
+	return obj.GetKind() + "/" + obj.GetNamespace() + "/" + obj.GetName()
+}
+
+// defaultNamespace returns the namespace kapp will use, that of our kubeconfig
+// or (in cluster) our service account.
+func defaultNamespace() string {
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{})
+
+	namespace, _, err := loader.Namespace()
+	if err != nil || namespace == "" {
+		return metav1.NamespaceDefault
+	}
+
+	return namespace
+}
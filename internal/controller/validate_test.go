@@ -0,0 +1,166 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dpeckett/ytt-operator/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// validatingClient stands in for the API servers validation of dry runs.
+type validatingClient struct {
+	client.Client
+	created []client.Object
+}
+
+func (c *validatingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	createOpts := (&client.CreateOptions{}).ApplyOptions(opts).AsCreateOptions()
+	if len(createOpts.DryRun) == 0 || createOpts.FieldValidation != "Strict" {
+		return errors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, obj.GetName(), nil)
+	}
+
+	c.created = append(c.created, obj)
+
+	switch obj.GetName() {
+	case "invalid":
+		return errors.NewInvalid(schema.GroupKind{Kind: "ConfigMap"}, obj.GetName(), field.ErrorList{
+			field.Invalid(field.NewPath("data", "password"), "hunter2", "must be a string"),
+		})
+	case "typo":
+		return errors.NewBadRequest(`ConfigMap in version "v1" cannot be handled as a ConfigMap: strict decoding error: unknown field "datta"`)
+	case "existing":
+		return errors.NewAlreadyExists(schema.GroupResource{Resource: "configmaps"}, obj.GetName())
+	}
+
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: typo
+datta:
+  foo: bar
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: invalid
+data:
+  password: #@ data.values.spec.password
+`), 0o644))
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+
+	c := &validatingClient{Client: fake.NewClientBuilder().WithScheme(scheme).WithRESTMapper(mapper).Build()}
+	recorder := record.NewFakeRecorder(10)
+
+	r := &YTTReconciler{
+		Client:     c,
+		scriptsDir: dir,
+		redactor:   util.NewRedactor([]string{"data.password"}),
+		recorder:   recorder,
+		namespace:  "operators",
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("example.com/v1")
+	obj.SetKind("Database")
+	obj.SetNamespace("default")
+	obj.SetName("my-db")
+	ctx := context.Background()
+
+	t.Run("Valid", func(t *testing.T) {
+		out := []byte(`apiVersion: kapp.k14s.io/v1alpha1
+kind: Config
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: not-installed-yet
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: existing
+  namespace: team-a
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: new
+`)
+
+		c.created = nil
+		require.NoError(t, r.validate(ctx, obj, out))
+
+		require.Len(t, c.created, 2, "Only kinds known to the API server should be validated")
+		assert.Equal(t, "team-a", c.created[0].GetNamespace())
+		assert.Equal(t, "operators", c.created[1].GetNamespace(), "Resources should default to kapps namespace")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		out := []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: typo
+datta:
+  foo: bar
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: invalid
+data:
+  password: hunter2
+`)
+
+		err := r.validate(ctx, obj, out)
+		require.Error(t, err)
+
+		assert.Contains(t, err.Error(), `ConfigMap/operators/typo: ConfigMap in version "v1" cannot be handled as a ConfigMap: strict decoding error: unknown field "datta" (datta may be set at config.yaml:5)`)
+		assert.Contains(t, err.Error(), "ConfigMap/operators/invalid:")
+		assert.Contains(t, err.Error(), "(data.password may be set at config.yaml:13)")
+		assert.NotContains(t, err.Error(), "hunter2", "Sensitive values should be redacted")
+
+		require.Len(t, recorder.Events, 1)
+		assert.Contains(t, <-recorder.Events, reasonInvalidManifests)
+	})
+}
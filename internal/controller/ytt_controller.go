@@ -19,19 +19,37 @@ package controller
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	stderrors "errors"
 	"fmt"
 	"os/exec"
 	"strings"
+	"time"
 
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
 	"github.com/dpeckett/ytt-operator/internal/util"
-	"gopkg.in/yaml.v3"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 type YTTReconciler struct {
@@ -39,15 +57,60 @@ type YTTReconciler struct {
 	Scheme     *runtime.Scheme
 	gvk        schema.GroupVersionKind
 	scriptsDir string
+	spec       *v1beta1.ReconcilerSpec
+	selector   *objectSelector
+	redactor   *util.Redactor
+	pool       *util.ProcessPool
+	recorder   record.EventRecorder
+	drain      *Drain
+	// scriptsWatcher is set when running against a local scripts directory.
+	scriptsWatcher *ScriptsWatcher
+	// changes records pending changes in the Observe mode.
+	changes *ChangeReporter
+	// qualifiedAppNames includes the kind and namespace in kapp app names,
+	// objects handled by a ClusterReconciler can come from anywhere.
+	qualifiedAppNames bool
+	// namespace is where kapp puts namespaced resources that don't have one.
+	namespace string
 }
 
-func NewYTTReconciler(mgr ctrl.Manager, gvk schema.GroupVersionKind, scriptsDir string) *YTTReconciler {
-	return &YTTReconciler{
-		Client:     mgr.GetClient(),
-		Scheme:     mgr.GetScheme(),
-		gvk:        gvk,
-		scriptsDir: scriptsDir,
+// Event reasons.
+const (
+	reasonRenderFailed = "RenderFailed"
+	reasonPlanFailed   = "PlanFailed"
+	reasonDeployFailed = "DeployFailed"
+	reasonDeleteFailed = "DeleteFailed"
+	reasonTimeout      = "Timeout"
+	reasonPaused       = "Paused"
+	reasonResumed      = "Resumed"
+
+	reasonDeletionBlocked   = "DeletionBlocked"
+	reasonDeletionAbandoned = "DeletionAbandoned"
+	reasonForceFinalized    = "ForceFinalized"
+)
+
+func NewYTTReconciler(mgr ctrl.Manager, gvk schema.GroupVersionKind, scriptsDir string, spec *v1beta1.ReconcilerSpec, pool *util.ProcessPool, drain *Drain, scriptsWatcher *ScriptsWatcher, changes *ChangeReporter, qualifiedAppNames bool) (*YTTReconciler, error) {
+	selector, err := newObjectSelector(spec, gvk)
+	if err != nil {
+		return nil, err
 	}
+
+	return &YTTReconciler{
+		Client:            mgr.GetClient(),
+		Scheme:            mgr.GetScheme(),
+		gvk:               gvk,
+		scriptsDir:        scriptsDir,
+		spec:              spec,
+		selector:          selector,
+		redactor:          util.NewRedactor(spec.SensitiveFields),
+		pool:              pool,
+		recorder:          mgr.GetEventRecorderFor("ytt-operator"),
+		drain:             drain,
+		scriptsWatcher:    scriptsWatcher,
+		changes:           changes,
+		qualifiedAppNames: qualifiedAppNames,
+		namespace:         defaultNamespace(),
+	}, nil
 }
 
 func (r *YTTReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -61,76 +124,725 @@ func (r *YTTReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 	err := r.Get(ctx, req.NamespacedName, &obj)
 	if err != nil {
 		if errors.IsNotFound(err) {
-			return ctrl.Result{}, nil
+			return ctrl.Result{}, r.changes.Clear(ctx, r.gvk, req.NamespacedName)
 		}
 
 		return ctrl.Result{}, fmt.Errorf("failed to get object: %w", err)
 	}
 
-	if obj.GetDeletionTimestamp() != nil {
-		logger.Info("Deleting object resources using kapp")
+	// While the reconciler itself is being deleted, every object is treated
+	// as if it were being deleted (without actually deleting it).
+	_, draining := r.drain.Since()
+	deleting := obj.GetDeletionTimestamp() != nil || draining
+
+	// Other reconcilers can share the kind (and our finalizer), their
+	// objects are left for them to release.
+	released := false
+	if deleting {
+		released, err = r.releases(ctx, &obj)
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to check object owner: %w", err)
+		}
+	}
+
+	// Objects claimed before switching to the Observe mode still need to be
+	// released, otherwise they would be stuck deleting.
+	if r.spec.Mode == v1beta1.ReconcilerModeObserve && !released {
+		return r.observe(ctx, &obj)
+	}
+
+	if deleting && !released {
+		return ctrl.Result{}, nil
+	}
+
+	if deleting && obj.GetAnnotations()[forceFinalizeAnnotation] == "true" {
+		return r.forceFinalize(ctx, &obj)
+	}
 
-		cmd := exec.CommandContext(ctx, "kapp", "delete", "-y", "-a", obj.GetName())
-		cmd.Stdout = util.NewKappLogInterceptor(logger, false)
-		cmd.Stderr = util.NewKappLogInterceptor(logger, true)
+	// Paused objects are left alone entirely (including deletion, so that
+	// the finalizer stays in place until the object is resumed).
+	if message := r.pausedMessage(&obj); message != "" {
+		logger.Info("Reconciliation paused", "reason", message)
 
-		if err := cmd.Run(); err != nil {
-			logger.Error(err, "Kapp delete failed")
+		changed, err := setCondition(ctx, r.Client, &obj, metav1.Condition{
+			Type:    conditionPaused,
+			Status:  metav1.ConditionTrue,
+			Reason:  reasonPaused,
+			Message: message,
+		}, false)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
 
-			return ctrl.Result{}, fmt.Errorf("kapp delete failed: %w", err)
+		if changed {
+			r.recorder.Event(&obj, corev1.EventTypeNormal, reasonPaused, message)
 		}
 
-		logger.Info("Removing finalizer")
+		// Pausing doesn't stop the deletion deadline.
+		if deleting && controllerutil.ContainsFinalizer(&obj, finalizer) {
+			if deadline := r.deletionDeadline(&obj); !deadline.IsZero() {
+				if time.Now().After(deadline) {
+					return r.abandonDeletion(ctx, &obj, message)
+				}
 
-		if err := removeFinalizer(ctx, r.Client, &obj); err != nil {
-			return ctrl.Result{}, fmt.Errorf("failed to remove finalizer: %w", err)
+				return ctrl.Result{RequeueAfter: time.Until(deadline)}, nil
+			}
 		}
 
 		return ctrl.Result{}, nil
 	}
 
-	// Add finalizer if it's not already present.
-	if err := addFinalizer(ctx, r.Client, &obj); err != nil {
+	changed, err := setCondition(ctx, r.Client, &obj, metav1.Condition{Type: conditionPaused}, true)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if changed {
+		r.recorder.Event(&obj, corev1.EventTypeNormal, reasonResumed, "Reconciliation resumed")
+	}
+
+	// Left over from the Observe mode (the reconcilers status is cleared by
+	// the parent).
+	if _, err := setCondition(ctx, r.Client, &obj, metav1.Condition{Type: conditionPendingChanges}, true); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if deleting {
+		return r.finalize(ctx, &obj)
+	}
+
+	selected, err := r.selector.Matches(ctx, r.Client, &obj)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to match object: %w", err)
+	}
+
+	if !selected {
+		logger.Info("Object not selected, skipping")
+
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.claim(ctx, &obj); err != nil {
 		return ctrl.Result{}, fmt.Errorf("failed to add finalizer: %w", err)
 	}
 
-	objYAML, err := yaml.Marshal(obj.Object)
+	out, err := r.render(ctx, &obj)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.validate(ctx, &obj, out); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	check, err := r.checkSafety(ctx, &obj, out)
 	if err != nil {
-		return ctrl.Result{}, fmt.Errorf("failed to marshal object: %w", err)
+		return ctrl.Result{}, err
+	}
+
+	if check.reason != "" {
+		if obj.GetAnnotations()[approvedPlanAnnotation] != check.plan.Hash() {
+			return ctrl.Result{}, r.blocked(ctx, &obj, check)
+		}
+
+		logger.Info("Deploying approved plan", "plan", check.plan.Hash())
+	}
+
+	if err := r.deploy(ctx, &obj, out, check.empty); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.clearApproval(ctx, &obj); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if _, err := setCondition(ctx, r.Client, &obj, metav1.Condition{Type: conditionBlocked}, true); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// claim adds our finalizer to an object (if it's not already present), along
+// with the owner label of this reconciler. An object that was claimed by
+// another reconciler keeps its owner.
+func (r *YTTReconciler) claim(ctx context.Context, obj *unstructured.Unstructured) error {
+	owner := r.drain.Owner()
+
+	_, labelled := obj.GetLabels()[ownerLabel]
+	if controllerutil.ContainsFinalizer(obj, finalizer) && (labelled || owner == "") {
+		return nil
+	}
+
+	clone := obj.DeepCopy()
+	controllerutil.AddFinalizer(clone, finalizer)
+
+	if !labelled && owner != "" {
+		labels := clone.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[ownerLabel] = owner
+		clone.SetLabels(labels)
+	}
+
+	return r.Patch(ctx, clone, client.MergeFrom(obj))
+}
+
+// releases returns true if we are responsible for removing our finalizer
+// from an object that is being deleted (or drained). Objects claimed before
+// the owner label was introduced are released when they are deleted, but
+// only drained if they are still selected by this reconciler. In the Observe
+// mode only the objects claimed before switching mode are released.
+func (r *YTTReconciler) releases(ctx context.Context, obj client.Object) (bool, error) {
+	// Anything else could belong to the reconciler being shadowed.
+	if r.spec.Mode == v1beta1.ReconcilerModeObserve {
+		return r.claimed(obj), nil
+	}
+
+	if !controllerutil.ContainsFinalizer(obj, finalizer) {
+		return false, nil
+	}
+
+	if owner, ok := obj.GetLabels()[ownerLabel]; ok {
+		return owner == r.drain.Owner(), nil
+	}
+
+	if obj.GetDeletionTimestamp() != nil {
+		return true, nil
+	}
+
+	return r.selector.Matches(ctx, r.Client, obj)
+}
+
+// finalize cleans up the resources of an object that is being deleted, and
+// then removes our finalizer.
+func (r *YTTReconciler) finalize(ctx context.Context, obj *unstructured.Unstructured) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if !controllerutil.ContainsFinalizer(obj, finalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.cleanup(ctx, obj); err != nil {
+		return r.deletionBlocked(ctx, obj, err)
+	}
+
+	logger.Info("Removing finalizer")
+
+	if err := removeFinalizer(ctx, r.Client, obj); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to remove finalizer: %w", err)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// cleanup deletes (or orphans) the resources generated for an object.
+func (r *YTTReconciler) cleanup(ctx context.Context, obj *unstructured.Unstructured) error {
+	logger := log.FromContext(ctx)
+
+	policy, err := r.deletionPolicy(obj)
+	if err != nil {
+		r.recordFailure(obj, reasonDeleteFailed, err)
+
+		return err
+	}
+
+	if policy == v1beta1.DeletionPolicyOrphan {
+		if err := r.orphan(ctx, obj); err != nil {
+			return err
+		}
+	}
+
+	logger.Info("Deleting object resources using kapp")
+
+	cmd := exec.Command("kapp", r.kappArgs("delete", "-y", "-a", r.appName(obj))...)
+	cmd.Stdout = util.NewKappLogInterceptor(logger, false, nil)
+	cmd.Stderr = util.NewKappLogInterceptor(logger, true, nil)
+
+	if err := r.run(ctx, cmd, durationOf(r.timeouts().Delete)); err != nil {
+		logger.Error(err, "Kapp delete failed")
+		r.recordFailure(obj, reasonDeleteFailed, fmt.Errorf("kapp delete failed: %w", err))
+
+		return fmt.Errorf("kapp delete failed: %w", err)
+	}
+
+	return nil
+}
+
+// deletionRetryInterval is how often a blocked cleanup is retried while
+// waiting for the deletion deadline.
+const deletionRetryInterval = 30 * time.Second
+
+// deletionBlocked reports why an objects resources couldn't be cleaned up.
+// Once the deletion deadline has passed we give up and remove the finalizer,
+// rather than leaving the object (and its namespace) stuck forever.
+func (r *YTTReconciler) deletionBlocked(ctx context.Context, obj *unstructured.Unstructured, cause error) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	deadline := r.deletionDeadline(obj)
+	if !deadline.IsZero() && time.Now().After(deadline) {
+		return r.abandonDeletion(ctx, obj, cause.Error())
+	}
+
+	message := fmt.Sprintf("Unable to clean up resources: %v", cause)
+	if !deadline.IsZero() {
+		message += fmt.Sprintf(", will give up at %s", deadline.UTC().Format(time.RFC3339))
+	}
+	message += fmt.Sprintf(" (set the %s annotation to remove the finalizer now)", forceFinalizeAnnotation)
+
+	r.recorder.Event(obj, corev1.EventTypeWarning, reasonDeletionBlocked, message)
+
+	_, err := setCondition(ctx, r.Client, obj, metav1.Condition{
+		Type:    conditionDeletionBlocked,
+		Status:  metav1.ConditionTrue,
+		Reason:  reasonDeletionBlocked,
+		Message: message,
+	}, false)
+	if err != nil {
+		logger.Error(err, "Failed to update status")
+	}
+
+	if deadline.IsZero() {
+		return ctrl.Result{}, cause
+	}
+
+	// Error backoff could take us well past the deadline, so make sure we
+	// are back in time to give up.
+	logger.Error(cause, "Unable to clean up resources")
+
+	return ctrl.Result{RequeueAfter: minDuration(time.Until(deadline), deletionRetryInterval)}, nil
+}
+
+// deletionDeadline returns when we give up on cleaning up an objects
+// resources, or the zero time if we never do.
+func (r *YTTReconciler) deletionDeadline(obj *unstructured.Unstructured) time.Time {
+	d := durationOf(r.spec.DeletionDeadline)
+	if d <= 0 {
+		return time.Time{}
+	}
+
+	if obj.GetDeletionTimestamp() != nil {
+		return obj.GetDeletionTimestamp().Add(d)
+	}
+
+	if since, ok := r.drain.Since(); ok {
+		return since.Add(d)
+	}
+
+	return time.Time{}
+}
+
+// abandonDeletion removes our finalizer without cleaning up, once the
+// deletion deadline has passed.
+func (r *YTTReconciler) abandonDeletion(ctx context.Context, obj *unstructured.Unstructured, reason string) (ctrl.Result, error) {
+	log.FromContext(ctx).Info("Deletion deadline exceeded, removing finalizer")
+
+	r.recorder.Event(obj, corev1.EventTypeWarning, reasonDeletionAbandoned,
+		fmt.Sprintf("Deletion deadline exceeded, resources may have been left behind: %s", reason))
+
+	if err := removeFinalizer(ctx, r.Client, obj); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to remove finalizer: %w", err)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// forceFinalize removes our finalizer without cleaning up any resources.
+func (r *YTTReconciler) forceFinalize(ctx context.Context, obj *unstructured.Unstructured) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(obj, finalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	log.FromContext(ctx).Info("Force finalizing object")
+
+	r.recorder.Event(obj, corev1.EventTypeWarning, reasonForceFinalized,
+		"Finalizer removed due to the "+forceFinalizeAnnotation+" annotation, resources may have been left behind")
+
+	if err := removeFinalizer(ctx, r.Client, obj); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to remove finalizer: %w", err)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// render evaluates the ytt templates, passing in the object as a data value.
+func (r *YTTReconciler) render(ctx context.Context, obj *unstructured.Unstructured) ([]byte, error) {
+	logger := log.FromContext(ctx)
+
+	values, err := util.DataValues(obj.Object)
+	if err != nil {
+		return nil, err
 	}
 
 	logger.Info("Invoking ytt")
 
-	cmd := exec.CommandContext(ctx, "ytt", "-f", r.scriptsDir, "-f", "-")
-	cmd.Stdin = strings.NewReader("#@data/values\n---\n" + string(objYAML))
-	out, err := cmd.CombinedOutput()
+	var outBuf bytes.Buffer
+	cmd := util.RenderCommand("ytt", r.scriptsDir, values, &outBuf)
+
+	err = r.run(ctx, cmd, durationOf(r.timeouts().Render))
+	out := outBuf.Bytes()
+	if err != nil {
+		// Ytt errors can quote the data values, so mask anything sensitive in the object.
+		_, redaction := r.redactor.Redact(values)
+		logger.Error(err, "Ytt failed", "output", redaction.String(string(out)))
+		r.recordFailure(obj, reasonRenderFailed, fmt.Errorf("ytt failed: %w", err))
+
+		return nil, fmt.Errorf("ytt failed: %w", err)
+	}
+
+	return out, nil
+}
+
+// Render renders an object without a cluster (eg. for the render command),
+// producing exactly the manifests a reconciler would pass to kapp.
+func Render(ctx context.Context, yttPath, scriptsDir string, obj *unstructured.Unstructured) ([]byte, error) {
+	obj = obj.DeepCopy()
+
+	// Reconcilers add their finalizer before rendering, so the scripts see it.
+	controllerutil.AddFinalizer(obj, finalizer)
+
+	values, err := util.DataValues(obj.Object)
 	if err != nil {
-		logger.Error(err, "Ytt failed", "output", string(out))
+		return nil, err
+	}
 
-		return ctrl.Result{}, fmt.Errorf("ytt failed: %w", err)
+	var outBuf bytes.Buffer
+	if err := util.RunCommand(ctx, util.RenderCommand(yttPath, scriptsDir, values, &outBuf)); err != nil {
+		return nil, fmt.Errorf("ytt failed: %w: %s", err, strings.TrimSpace(outBuf.String()))
 	}
 
+	return outBuf.Bytes(), nil
+}
+
+// deploy applies the rendered manifests using kapp. Unless allowEmpty is set,
+// kapp will refuse to deploy an empty set of manifests.
+func (r *YTTReconciler) deploy(ctx context.Context, obj *unstructured.Unstructured, out []byte, allowEmpty bool) error {
+	logger := log.FromContext(ctx)
+
 	logger.Info("Deploying manifests using kapp")
 
-	cmd = exec.CommandContext(ctx, "kapp", "deploy", "-y", "-a", obj.GetName(), "-f", "-")
+	args := []string{"deploy", "-y", "-a", r.appName(obj), "-f", "-"}
+	if allowEmpty {
+		args = append(args, "--dangerous-allow-empty-list-of-resources")
+	}
+
+	cmd := exec.Command("kapp", r.kappArgs(args...)...)
+	redacted, redaction := r.redactor.Redact(out)
+
 	cmd.Stdin = bytes.NewReader(out)
-	cmd.Stdout = util.NewKappLogInterceptor(logger, false)
-	cmd.Stderr = util.NewKappLogInterceptor(logger, true)
+	cmd.Stdout = util.NewKappLogInterceptor(logger, false, redaction)
+	cmd.Stderr = util.NewKappLogInterceptor(logger, true, redaction)
 
-	if err := cmd.Run(); err != nil {
-		logger.Error(err, "Kapp deploy failed", "output", string(out))
+	if err := r.run(ctx, cmd, durationOf(r.timeouts().Deploy)); err != nil {
+		logger.Error(err, "Kapp deploy failed", "output", string(redacted))
+		r.recordFailure(obj, reasonDeployFailed, fmt.Errorf("kapp deploy failed: %w", err))
 
-		return ctrl.Result{}, fmt.Errorf("kapp deploy failed: %w", err)
+		return fmt.Errorf("kapp deploy failed: %w", err)
 	}
 
-	return ctrl.Result{}, nil
+	return nil
+}
+
+// deletionPolicy returns the deletion policy for an object, the annotation
+// takes precedence over the reconciler spec.
+func (r *YTTReconciler) deletionPolicy(obj client.Object) (v1beta1.DeletionPolicy, error) {
+	if value, ok := obj.GetAnnotations()[deletionPolicyAnnotation]; ok {
+		for _, policy := range []v1beta1.DeletionPolicy{v1beta1.DeletionPolicyDelete, v1beta1.DeletionPolicyOrphan} {
+			if strings.EqualFold(value, string(policy)) {
+				return policy, nil
+			}
+		}
+
+		// Better to get stuck than to delete something that was meant to be kept.
+		return "", fmt.Errorf("invalid %s annotation: %q", deletionPolicyAnnotation, value)
+	}
+
+	if r.spec.DeletionPolicy == "" {
+		return v1beta1.DeletionPolicyDelete, nil
+	}
+
+	return r.spec.DeletionPolicy, nil
+}
+
+// run runs an external command once a slot in the process pool is available.
+// If timeout is non-zero, the command will be killed once it has elapsed.
+func (r *YTTReconciler) run(ctx context.Context, cmd *exec.Cmd, timeout time.Duration) error {
+	release, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire process slot: %w", err)
+	}
+	defer release()
+
+	// Time spent waiting for a slot doesn't count towards the timeout.
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if err := util.RunCommand(ctx, cmd); err != nil {
+		if stderrors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("timed out after %s: %w", timeout, err)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// pausedMessage returns a description of why the object is paused, or an
+// empty string if it is not.
+func (r *YTTReconciler) pausedMessage(obj client.Object) string {
+	if r.spec.Suspend {
+		return "Reconciler is suspended"
+	}
+
+	if obj.GetAnnotations()[pausedAnnotation] == "true" {
+		return "Object has the " + pausedAnnotation + " annotation"
+	}
+
+	return ""
+}
+
+// maxAppNameLength keeps kapp app names (and the config maps kapp derives
+// from them) within the Kubernetes name length limits.
+const maxAppNameLength = 200
+
+// appName returns the kapp app name used for an object.
+func (r *YTTReconciler) appName(obj client.Object) string {
+	if !r.qualifiedAppNames {
+		return obj.GetName()
+	}
+
+	parts := []string{strings.ToLower(r.gvk.Kind)}
+	if obj.GetNamespace() != "" {
+		parts = append(parts, obj.GetNamespace())
+	}
+	name := strings.Join(append(parts, obj.GetName()), ".")
+
+	if len(name) > maxAppNameLength {
+		sum := sha256.Sum256([]byte(name))
+		name = name[:maxAppNameLength-17] + "-" + hex.EncodeToString(sum[:])[:16]
+	}
+
+	return name
+}
+
+// kappArgs appends any global kapp flags to the given arguments.
+func (r *YTTReconciler) kappArgs(args ...string) []string {
+	if d := durationOf(r.timeouts().KappWait); d > 0 {
+		args = append(args, "--wait-timeout", d.String())
+	}
+
+	return args
+}
+
+func (r *YTTReconciler) timeouts() *v1beta1.ReconcilerTimeoutsSpec {
+	if r.spec.Timeouts == nil {
+		return &v1beta1.ReconcilerTimeoutsSpec{}
+	}
+
+	return r.spec.Timeouts
+}
+
+// recordFailure records a warning event against the object. Timeouts are
+// given their own reason so that they can be told apart from other failures.
+func (r *YTTReconciler) recordFailure(obj client.Object, reason string, err error) {
+	if stderrors.Is(err, context.DeadlineExceeded) {
+		reason = reasonTimeout
+	}
+
+	r.recorder.Event(obj, corev1.EventTypeWarning, reason, err.Error())
+}
+
+func durationOf(d *metav1.Duration) time.Duration {
+	if d == nil {
+		return 0
+	}
+
+	return d.Duration
 }
 
 func (r *YTTReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	c, err := controller.New(strings.ToLower(r.gvk.Kind), mgr, r.controllerOptions())
+	if err != nil {
+		return err
+	}
+
+	return r.watch(context.Background(), mgr, c, mgr.GetCache())
+}
+
+// Start runs the reconciler until the context is cancelled. Unlike
+// SetupWithManager, the objects are watched using a cache of their own, so
+// that nothing is left watching the kind once the reconciler is stopped.
+func (r *YTTReconciler) Start(ctx context.Context, mgr ctrl.Manager, newCache cache.NewCacheFunc) error {
+	if newCache == nil {
+		newCache = cache.New
+	}
+
+	kindCache, err := newCache(mgr.GetConfig(), cache.Options{Scheme: mgr.GetScheme(), Mapper: mgr.GetRESTMapper()})
+	if err != nil {
+		return fmt.Errorf("failed to create cache: %w", err)
+	}
+
+	c, err := controller.NewUnmanaged(strings.ToLower(r.gvk.Kind), mgr, r.controllerOptions())
+	if err != nil {
+		return err
+	}
+
+	if err := r.watch(ctx, mgr, c, kindCache); err != nil {
+		return err
+	}
+
+	go func() {
+		if err := kindCache.Start(ctx); err != nil {
+			log.FromContext(ctx).Error(err, "Cache failed", "gvk", r.gvk.String())
+		}
+	}()
+
+	return c.Start(ctx)
+}
+
+// watch sets up the watches of the controller, objects of the reconciled
+// kind are watched using kindCache. Anything registered is unregistered once
+// the context is cancelled, the reconciler can be started again later.
+func (r *YTTReconciler) watch(ctx context.Context, mgr ctrl.Manager, c controller.Controller, kindCache cache.Cache) error {
 	var obj unstructured.Unstructured
 	obj.SetGroupVersionKind(r.gvk)
 
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&obj).
-		Complete(r)
+	err := c.Watch(source.NewKindWithCache(&obj, kindCache), &handler.EnqueueRequestForObject{},
+		predicate.NewPredicateFuncs(r.selector.Filter(r.Client)))
+	if err != nil {
+		return err
+	}
+
+	// Once draining starts, every object needs to be revisited.
+	if r.drain != nil {
+		events := make(chan event.GenericEvent)
+		if err := c.Watch(&source.Channel{Source: events}, &handler.EnqueueRequestForObject{}); err != nil {
+			return err
+		}
+
+		unregister := r.drain.OnStart(func() {
+			go r.enqueueAll(ctx, events)
+		})
+		go unregisterOnDone(ctx, unregister)
+	}
+
+	// Changed scripts need to be rendered again for every object.
+	if r.scriptsWatcher != nil {
+		events := make(chan event.GenericEvent)
+		if err := c.Watch(&source.Channel{Source: events}, &handler.EnqueueRequestForObject{}); err != nil {
+			return err
+		}
+
+		unregister := r.scriptsWatcher.OnChange(func() {
+			go r.enqueueAll(ctx, events)
+		})
+		go unregisterOnDone(ctx, unregister)
+	}
+
+	// Namespace label changes can cause objects to move in (or out) of scope.
+	if r.selector.hasNamespaceSelector() {
+		err := c.Watch(source.NewKindWithCache(&corev1.Namespace{}, mgr.GetCache()),
+			handler.EnqueueRequestsFromMapFunc(r.objectsInNamespace),
+			predicate.LabelChangedPredicate{})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func unregisterOnDone(ctx context.Context, unregister func()) {
+	<-ctx.Done()
+	unregister()
+}
+
+// controllerOptions returns the concurrency and rate limiting settings for the controller.
+func (r *YTTReconciler) controllerOptions() controller.Options {
+	opts := controller.Options{
+		MaxConcurrentReconciles: int(r.spec.MaxConcurrentReconciles),
+	}
+
+	if r.spec.RateLimit != nil {
+		// Same defaults as workqueue.DefaultControllerRateLimiter().
+		baseDelay, maxDelay := 5*time.Millisecond, 1000*time.Second
+		qps, burst := 10, 100
+
+		if r.spec.RateLimit.BaseDelay != nil {
+			baseDelay = r.spec.RateLimit.BaseDelay.Duration
+		}
+		if r.spec.RateLimit.MaxDelay != nil {
+			maxDelay = r.spec.RateLimit.MaxDelay.Duration
+		}
+		if r.spec.RateLimit.QPS > 0 {
+			qps = int(r.spec.RateLimit.QPS)
+		}
+		if r.spec.RateLimit.Burst > 0 {
+			burst = int(r.spec.RateLimit.Burst)
+		}
+
+		opts.RateLimiter = workqueue.NewMaxOfRateLimiter(
+			workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay),
+			&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(qps), burst)},
+		)
+	}
+
+	return opts
+}
+
+// enqueueAll sends an event for every watched object, until the context
+// is cancelled.
+func (r *YTTReconciler) enqueueAll(ctx context.Context, events chan<- event.GenericEvent) {
+	var list unstructured.UnstructuredList
+	list.SetGroupVersionKind(r.gvk.GroupVersion().WithKind(r.gvk.Kind + "List"))
+
+	if err := r.List(ctx, &list); err != nil {
+		if ctx.Err() == nil {
+			log.Log.Error(err, "Failed to list objects", "gvk", r.gvk.String())
+		}
+
+		return
+	}
+
+	for i := range list.Items {
+		select {
+		case events <- event.GenericEvent{Object: &list.Items[i]}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// objectsInNamespace maps a namespace to all the watched objects within it.
+func (r *YTTReconciler) objectsInNamespace(ns client.Object) []reconcile.Request {
+	var list unstructured.UnstructuredList
+	list.SetGroupVersionKind(r.gvk.GroupVersion().WithKind(r.gvk.Kind + "List"))
+
+	if err := r.List(context.Background(), &list, client.InNamespace(ns.GetName())); err != nil {
+		log.Log.Error(err, "Failed to list objects in namespace", "namespace", ns.GetName())
+
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, item := range list.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: item.GetName(), Namespace: item.GetNamespace()},
+		})
+	}
+
+	return requests
 }
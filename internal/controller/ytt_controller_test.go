@@ -22,7 +22,9 @@ import (
 	"time"
 
 	"github.com/dpeckett/ytt-operator/api/v1alpha1"
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
 	"github.com/dpeckett/ytt-operator/internal/controller"
+	"github.com/dpeckett/ytt-operator/internal/util"
 	"github.com/go-logr/zapr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -30,6 +32,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -89,7 +92,8 @@ func TestYTTReconciler(t *testing.T) {
 
 	gvk := schema.GroupVersionKind{Group: v1alpha1.GroupVersion.Group, Version: v1alpha1.GroupVersion.Version, Kind: "TestResource"}
 
-	r := controller.NewYTTReconciler(mgr, gvk, "testdata")
+	r, err := controller.NewYTTReconciler(mgr, gvk, "testdata", &v1beta1.ReconcilerSpec{}, util.NewProcessPool(1, 0), nil, nil, nil, false)
+	require.NoError(t, err)
 	err = r.SetupWithManager(mgr)
 	require.NoError(t, err)
 
@@ -145,4 +149,44 @@ func TestYTTReconciler(t *testing.T) {
 
 		assert.Equal(t, "default", cm.Data["namespace"])
 	})
+
+	t.Run("Test paused object", func(t *testing.T) {
+		obj := &v1alpha1.TestResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-paused",
+				Namespace: "default",
+				Annotations: map[string]string{
+					"ytt-operator.pecke.tt/paused": "true",
+				},
+			},
+			Spec: v1alpha1.TestResourceSpec{
+				Foo: "bar",
+			},
+		}
+
+		err = r.Client.Create(ctx, obj)
+		require.NoError(t, err)
+
+		defer func() {
+			t.Log("Cleaning up test object")
+
+			if err := r.Client.Delete(ctx, obj); err != nil {
+				t.Log(err)
+			}
+		}()
+
+		// Wait for the paused condition to be reported.
+		err = wait.PollImmediate(100*time.Millisecond, 10*time.Second, func() (bool, error) {
+			if err := r.Client.Get(ctx, types.NamespacedName{Name: obj.Name, Namespace: obj.Namespace}, obj); err != nil {
+				return false, nil
+			}
+
+			return meta.IsStatusConditionTrue(obj.Status.Conditions, "Paused"), nil
+		})
+		require.NoError(t, err)
+
+		_, err = clientset.CoreV1().ConfigMaps("default").Get(ctx,
+			"derived-configmap-test-paused", metav1.GetOptions{})
+		assert.True(t, errors.IsNotFound(err), "Resources should not be deployed for paused objects")
+	})
 }
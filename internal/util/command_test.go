@@ -0,0 +1,54 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunCommand(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		var out bytes.Buffer
+		cmd := exec.Command("sh", "-c", "echo hello")
+		cmd.Stdout = &out
+
+		require.NoError(t, RunCommand(context.Background(), cmd))
+		assert.Equal(t, "hello\n", out.String())
+	})
+
+	t.Run("Kills process group on timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		// The background sleep would keep stdout open if only the shell was killed.
+		var out bytes.Buffer
+		cmd := exec.Command("sh", "-c", "sleep 30 & sleep 30")
+		cmd.Stdout = &out
+
+		start := time.Now()
+		err := RunCommand(ctx, cmd)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), 10*time.Second)
+	})
+}
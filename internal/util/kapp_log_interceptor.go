@@ -30,15 +30,19 @@ var (
 )
 
 type KappLogInterceptor struct {
-	logger logr.Logger
-	stderr bool
-	b      bytes.Buffer
+	logger    logr.Logger
+	stderr    bool
+	redaction *Redaction
+	b         bytes.Buffer
 }
 
-func NewKappLogInterceptor(logger logr.Logger, stderr bool) *KappLogInterceptor {
+// NewKappLogInterceptor returns a writer that forwards kapp output to the
+// logger. If redaction is non-nil, sensitive values are masked in each line.
+func NewKappLogInterceptor(logger logr.Logger, stderr bool, redaction *Redaction) *KappLogInterceptor {
 	return &KappLogInterceptor{
-		logger: logger,
-		stderr: stderr,
+		logger:    logger,
+		stderr:    stderr,
+		redaction: redaction,
 	}
 }
 
@@ -47,7 +51,7 @@ func (l *KappLogInterceptor) Write(p []byte) (n int, err error) {
 
 	scanner := bufio.NewScanner(&l.b)
 	for scanner.Scan() {
-		str := strings.TrimSpace(scanner.Text())
+		str := l.redaction.String(strings.TrimSpace(scanner.Text()))
 		if str != "" {
 			matches := kappLogLine.FindStringSubmatch(str)
 			if matches == nil || len(matches) != 3 {
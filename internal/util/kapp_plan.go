@@ -0,0 +1,194 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kapp change operations.
+const (
+	KappOpCreate = "create"
+	KappOpUpdate = "update"
+	KappOpDelete = "delete"
+)
+
+// KappChange is a single resource change planned by kapp.
+type KappChange struct {
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Op        string `json:"op"`
+	// OpStrategy is set when the change is not a simple patch (eg. "fallback on replace").
+	OpStrategy string `json:"opStrategy,omitempty"`
+}
+
+func (c KappChange) String() string {
+	if c.Namespace == "" {
+		return c.Kind + "/" + c.Name
+	}
+
+	return c.Kind + "/" + c.Namespace + "/" + c.Name
+}
+
+// KappPlan is the set of changes kapp would make to deploy an app.
+type KappPlan struct {
+	Changes []KappChange `json:"changes"`
+	// Diff describes the content of each change, if kapp was run with
+	// --diff-changes.
+	Diff string `json:"-"`
+}
+
+// kappJSONOutput is the output of a kapp command run with --json.
+type kappJSONOutput struct {
+	Tables []struct {
+		Rows []map[string]string `json:"Rows"`
+	} `json:"Tables"`
+	Lines []string `json:"Lines"`
+}
+
+// ParseKappPlan parses the output of `kapp deploy --diff-run --json`.
+func ParseKappPlan(out []byte) (*KappPlan, error) {
+	var output kappJSONOutput
+	if err := json.Unmarshal(out, &output); err != nil {
+		return nil, fmt.Errorf("failed to parse kapp output: %w", err)
+	}
+
+	plan := &KappPlan{Diff: output.diff()}
+	for _, table := range output.Tables {
+		for _, row := range table.Rows {
+			op, ok := row["op"]
+			// Only the changes table has an op column, and noops have an empty one.
+			if !ok || op == "" || op == "noop" || op == "exists" {
+				continue
+			}
+
+			plan.Changes = append(plan.Changes, KappChange{
+				Namespace:  row["namespace"],
+				Name:       row["name"],
+				Kind:       row["kind"],
+				Op:         op,
+				OpStrategy: row["op_strategy"],
+			})
+		}
+	}
+
+	sort.Slice(plan.Changes, func(i, j int) bool {
+		return plan.Changes[i].String()+plan.Changes[i].Op < plan.Changes[j].String()+plan.Changes[j].Op
+	})
+
+	return plan, nil
+}
+
+// ParseKappDiff returns the text output of `kapp deploy --diff-run
+// --diff-changes --json`, which describes each change line by line.
+func ParseKappDiff(out []byte) (string, error) {
+	var output kappJSONOutput
+	if err := json.Unmarshal(out, &output); err != nil {
+		return "", fmt.Errorf("failed to parse kapp output: %w", err)
+	}
+
+	return output.diff(), nil
+}
+
+// diff returns the text lines of the output, other than those that describe
+// the cluster (rather than the changes).
+func (o *kappJSONOutput) diff() string {
+	var lines []string
+	for _, line := range o.Lines {
+		if !strings.HasPrefix(line, "Target cluster") {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// CountKappResources returns the number of resources listed by `kapp inspect --json`.
+func CountKappResources(out []byte) (int, error) {
+	var output kappJSONOutput
+	if err := json.Unmarshal(out, &output); err != nil {
+		return 0, fmt.Errorf("failed to parse kapp output: %w", err)
+	}
+
+	var count int
+	for _, table := range output.Tables {
+		count += len(table.Rows)
+	}
+
+	return count, nil
+}
+
+// Filter returns the changes with the given operation.
+func (p *KappPlan) Filter(op string) []KappChange {
+	var changes []KappChange
+	for _, c := range p.Changes {
+		if c.Op == op {
+			changes = append(changes, c)
+		}
+	}
+
+	return changes
+}
+
+// Hash returns a short, stable identifier for the plan. It is used to approve
+// a specific set of changes, so it covers what each change does (the diff) as
+// well as which resources change.
+func (p *KappPlan) Hash() string {
+	h := sha256.New()
+	for _, c := range p.Changes {
+		fmt.Fprintf(h, "%s %s %s\n", c.Op, c.OpStrategy, c.String())
+	}
+	fmt.Fprintf(h, "%s\n", p.Diff)
+
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// Summary returns a short human readable description of the plan.
+func (p *KappPlan) Summary() string {
+	const maxListed = 10
+
+	var parts []string
+	for _, op := range []string{KappOpDelete, KappOpUpdate, KappOpCreate} {
+		changes := p.Filter(op)
+		if len(changes) == 0 {
+			continue
+		}
+
+		var names []string
+		for i, c := range changes {
+			if i == maxListed {
+				names = append(names, fmt.Sprintf("and %d more", len(changes)-maxListed))
+				break
+			}
+			names = append(names, c.String())
+		}
+
+		parts = append(parts, fmt.Sprintf("%d to %s (%s)", len(changes), op, strings.Join(names, ", ")))
+	}
+
+	if len(parts) == 0 {
+		return "no changes"
+	}
+
+	return strings.Join(parts, "; ")
+}
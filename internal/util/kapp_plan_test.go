@@ -0,0 +1,76 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const kappDiffRunOutput = `{
+  "Tables": [
+    {
+      "Content": "",
+      "Header": {"age": "Age", "kind": "Kind", "name": "Name", "namespace": "Namespace", "op": "Op", "op_strategy": "Op st.", "wait_to": "Wait to"},
+      "Rows": [
+        {"age": "", "kind": "ConfigMap", "name": "b", "namespace": "default", "op": "delete", "op_strategy": "", "wait_to": "delete"},
+        {"age": "", "kind": "ConfigMap", "name": "a", "namespace": "default", "op": "delete", "op_strategy": "", "wait_to": "delete"},
+        {"age": "", "kind": "Deployment", "name": "c", "namespace": "default", "op": "update", "op_strategy": "fallback on replace", "wait_to": "reconcile"},
+        {"age": "", "kind": "ClusterRole", "name": "d", "namespace": "", "op": "create", "op_strategy": "", "wait_to": "reconcile"},
+        {"age": "", "kind": "Service", "name": "e", "namespace": "default", "op": "", "op_strategy": "", "wait_to": "reconcile"}
+      ],
+      "Notes": ["Op:      1 create, 2 delete, 1 update, 1 noop, 0 exists"]
+    }
+  ],
+  "Blocks": [],
+  "Lines": ["Target cluster 'https://127.0.0.1:6443'"]
+}`
+
+func TestParseKappPlan(t *testing.T) {
+	plan, err := ParseKappPlan([]byte(kappDiffRunOutput))
+	require.NoError(t, err)
+
+	require.Len(t, plan.Changes, 4, "Noops should be ignored")
+
+	deletes := plan.Filter(KappOpDelete)
+	require.Len(t, deletes, 2)
+	assert.Equal(t, "ConfigMap/default/a", deletes[0].String(), "Changes should be sorted")
+
+	assert.Equal(t, "2 to delete (ConfigMap/default/a, ConfigMap/default/b); 1 to update (Deployment/default/c); 1 to create (ClusterRole/d)", plan.Summary())
+
+	again, err := ParseKappPlan([]byte(kappDiffRunOutput))
+	require.NoError(t, err)
+	assert.Equal(t, plan.Hash(), again.Hash(), "Hash should be stable")
+
+	again.Diff = "@@ update deployment/c (apps/v1) namespace: default @@\n  10 - replicas: 1\n  10 + replicas: 3"
+	assert.NotEqual(t, plan.Hash(), again.Hash(), "Hash should change with the content of the changes")
+
+	again.Changes = again.Changes[1:]
+	assert.NotEqual(t, plan.Hash(), again.Hash(), "Hash should change with the plan")
+}
+
+func TestParseKappDiff(t *testing.T) {
+	diff, err := ParseKappDiff([]byte(kappDiffRunOutput))
+	require.NoError(t, err)
+	assert.Empty(t, diff, "Kapps preamble isn't part of the diff")
+
+	diff, err = ParseKappDiff([]byte(`{"Lines": ["Target cluster 'https://127.0.0.1:6443'", "@@ create configmap/a (v1) namespace: default @@", "      0 + apiVersion: v1"]}`))
+	require.NoError(t, err)
+	assert.Equal(t, "@@ create configmap/a (v1) namespace: default @@\n      0 + apiVersion: v1", diff)
+}
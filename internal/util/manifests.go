@@ -0,0 +1,135 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// SplitManifests decodes a multi-document YAML stream. Empty documents are skipped.
+func SplitManifests(data []byte) ([]map[string]interface{}, error) {
+	var docs []map[string]interface{}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc map[string]interface{}
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			return nil, fmt.Errorf("failed to decode manifest: %w", err)
+		}
+
+		if doc != nil {
+			docs = append(docs, doc)
+		}
+	}
+
+	return docs, nil
+}
+
+// JoinManifests encodes documents into a multi-document YAML stream.
+func JoinManifests(docs []map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			return nil, fmt.Errorf("failed to encode manifest: %w", err)
+		}
+	}
+
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ReadObject reads a single object from a YAML file. It is decoded as it
+// would be from the API server (eg. numbers are int64 or float64).
+func ReadObject(path string) (*unstructured.Unstructured, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	defer f.Close()
+
+	objs, err := DecodeManifests(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+
+	if len(objs) != 1 {
+		return nil, fmt.Errorf("expected a single object in %s, found %d", path, len(objs))
+	}
+
+	return objs[0], nil
+}
+
+// DecodeManifests decodes a multi-document YAML stream into objects, as they
+// would be decoded from the API server. Empty documents are skipped.
+func DecodeManifests(r io.Reader) ([]*unstructured.Unstructured, error) {
+	var objs []*unstructured.Unstructured
+
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+	for {
+		doc, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			return nil, err
+		}
+
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+
+		objJSON, err := sigsyaml.YAMLToJSON(doc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode manifest: %w", err)
+		}
+
+		if string(objJSON) == "null" {
+			continue
+		}
+
+		var obj unstructured.Unstructured
+		if err := obj.UnmarshalJSON(objJSON); err != nil {
+			return nil, fmt.Errorf("failed to decode manifest: %w", err)
+		}
+
+		objs = append(objs, &obj)
+	}
+
+	return objs, nil
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeManifests(t *testing.T) {
+	in := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+data:
+  replicas: "3"
+---
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: b
+  annotations:
+    foo: bar
+`
+
+	objs, err := DecodeManifests(strings.NewReader(in))
+	require.NoError(t, err)
+	require.Len(t, objs, 2, "Empty documents should be dropped")
+
+	assert.Equal(t, "a", objs[0].GetName())
+	assert.Equal(t, map[string]string{"foo": "bar"}, objs[1].GetAnnotations())
+
+	// Objects should be safe to deep copy (ie. decoded with JSON types).
+	assert.Equal(t, objs[0], objs[0].DeepCopy())
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	processQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ytt_operator_process_queue_depth",
+		Help: "Number of external processes waiting for a slot in the process pool.",
+	})
+	processesRunning = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ytt_operator_processes_running",
+		Help: "Number of external processes currently running.",
+	})
+	processWaitSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ytt_operator_process_wait_seconds",
+		Help:    "Time spent waiting for a slot in the process pool.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 8),
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(processQueueDepth, processesRunning, processWaitSeconds)
+}
+
+// memoryPollInterval is how often we re-check memory usage while waiting.
+const memoryPollInterval = 500 * time.Millisecond
+
+// ProcessPool bounds the number of external processes (ytt, kapp) that may run
+// at once, across all of the controllers in this process. It will also hold
+// back new processes while memory usage is close to the containers limit.
+type ProcessPool struct {
+	slots           chan struct{}
+	memoryThreshold float64
+	// memoryUsage returns the current memory usage and limit in bytes.
+	memoryUsage func() (usage, limit uint64, ok bool)
+
+	mu      sync.Mutex
+	running int
+}
+
+// NewProcessPool creates a pool that will run at most size processes at once.
+// If memoryThreshold is non-zero, no new processes will be started (beyond the
+// first) while memory usage is above that fraction of the cgroup memory limit.
+func NewProcessPool(size int, memoryThreshold float64) *ProcessPool {
+	if size < 1 {
+		size = 1
+	}
+
+	return &ProcessPool{
+		slots:           make(chan struct{}, size),
+		memoryThreshold: memoryThreshold,
+		memoryUsage:     cgroupMemoryUsage,
+	}
+}
+
+// Acquire blocks until a process slot is available. The returned function
+// must be called to release the slot once the process has exited.
+func (p *ProcessPool) Acquire(ctx context.Context) (func(), error) {
+	processQueueDepth.Inc()
+	defer processQueueDepth.Dec()
+
+	start := time.Now()
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if err := p.waitForMemory(ctx); err != nil {
+		<-p.slots
+		return nil, err
+	}
+
+	processWaitSeconds.Observe(time.Since(start).Seconds())
+
+	p.mu.Lock()
+	p.running++
+	p.mu.Unlock()
+	processesRunning.Inc()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.mu.Lock()
+			p.running--
+			p.mu.Unlock()
+			processesRunning.Dec()
+
+			<-p.slots
+		})
+	}, nil
+}
+
+// waitForMemory blocks while memory usage is above the threshold. We always
+// allow at least one process to run so that we can't deadlock.
+func (p *ProcessPool) waitForMemory(ctx context.Context) error {
+	if p.memoryThreshold <= 0 {
+		return nil
+	}
+
+	for {
+		p.mu.Lock()
+		running := p.running
+		p.mu.Unlock()
+
+		if running == 0 {
+			return nil
+		}
+
+		usage, limit, ok := p.memoryUsage()
+		if !ok || float64(usage) < p.memoryThreshold*float64(limit) {
+			return nil
+		}
+
+		select {
+		case <-time.After(memoryPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// cgroupMemoryUsage reads the memory usage and limit of the current cgroup
+// (supports both cgroup v1 and v2).
+func cgroupMemoryUsage() (uint64, uint64, bool) {
+	for _, files := range [][2]string{
+		{"/sys/fs/cgroup/memory.current", "/sys/fs/cgroup/memory.max"},
+		{"/sys/fs/cgroup/memory/memory.usage_in_bytes", "/sys/fs/cgroup/memory/memory.limit_in_bytes"},
+	} {
+		usage, ok := readUint(files[0])
+		if !ok {
+			continue
+		}
+
+		// An unparseable limit means "max", eg. unlimited.
+		limit, ok := readUint(files[1])
+		if !ok || limit == 0 {
+			return 0, 0, false
+		}
+
+		return usage, limit, true
+	}
+
+	return 0, 0, false
+}
+
+func readUint(path string) (uint64, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+
+	v, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return v, true
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessPool(t *testing.T) {
+	t.Run("Bounds concurrent processes", func(t *testing.T) {
+		pool := NewProcessPool(1, 0)
+
+		release, err := pool.Acquire(context.Background())
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err = pool.Acquire(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded, "Second process should wait for a slot")
+
+		release()
+		// Releasing twice should be harmless.
+		release()
+
+		release, err = pool.Acquire(context.Background())
+		require.NoError(t, err)
+		release()
+	})
+
+	t.Run("Waits for memory", func(t *testing.T) {
+		pool := NewProcessPool(2, 0.8)
+
+		var usage uint64 = 90
+		pool.memoryUsage = func() (uint64, uint64, bool) {
+			return usage, 100, true
+		}
+
+		// The first process is always allowed to run.
+		release, err := pool.Acquire(context.Background())
+		require.NoError(t, err)
+		defer release()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err = pool.Acquire(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded, "Process should wait while memory usage is high")
+
+		usage = 50
+
+		release2, err := pool.Acquire(context.Background())
+		require.NoError(t, err)
+		release2()
+	})
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RedactedValue replaces sensitive values.
+const RedactedValue = "<redacted>"
+
+// minRedactedLength is the shortest value that will be masked in free text,
+// anything shorter would mangle unrelated output.
+const minRedactedLength = 4
+
+// Redactor masks sensitive values in manifests. Secret data and stringData
+// are always masked, along with any configured field paths.
+type Redactor struct {
+	paths [][]string
+}
+
+// NewRedactor returns a redactor for the given field paths. Paths are dot
+// separated (eg. "spec.credentials.password"), a "*" segment matches any map
+// key or list element.
+func NewRedactor(paths []string) *Redactor {
+	r := &Redactor{}
+	for _, p := range paths {
+		if p = strings.TrimSpace(p); p != "" {
+			r.paths = append(r.paths, strings.Split(p, "."))
+		}
+	}
+
+	return r
+}
+
+// Redact returns a copy of a YAML stream with sensitive values masked, and a
+// Redaction that masks the same values elsewhere (eg. in command output).
+// Data that isn't valid YAML can't be searched for sensitive values, so it is
+// masked entirely (as is any text the Redaction is applied to).
+func (r *Redactor) Redact(data []byte) ([]byte, *Redaction) {
+	docs, err := SplitManifests(data)
+	if err != nil {
+		return []byte(RedactedValue), &Redaction{all: true}
+	}
+
+	redaction := &Redaction{}
+	for _, doc := range docs {
+		if kind, _ := doc["kind"].(string); kind == "Secret" {
+			for _, field := range []string{"data", "stringData"} {
+				values, ok := doc[field].(map[string]interface{})
+				if !ok {
+					continue
+				}
+
+				for k, v := range values {
+					redaction.add(v, field == "data")
+					values[k] = RedactedValue
+				}
+			}
+		}
+
+		for _, path := range r.paths {
+			redactPath(doc, path, redaction)
+		}
+	}
+
+	redacted, err := JoinManifests(docs)
+	if err != nil {
+		return []byte(RedactedValue), &Redaction{all: true}
+	}
+
+	redaction.sort()
+
+	return redacted, redaction
+}
+
+func redactPath(node interface{}, path []string, redaction *Redaction) {
+	if len(path) == 0 {
+		return
+	}
+
+	last := len(path) == 1
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, v := range n {
+			if path[0] != "*" && path[0] != k {
+				continue
+			}
+
+			if last {
+				redaction.add(v, false)
+				n[k] = RedactedValue
+			} else {
+				redactPath(v, path[1:], redaction)
+			}
+		}
+	case []interface{}:
+		if path[0] != "*" {
+			return
+		}
+
+		for i, v := range n {
+			if last {
+				redaction.add(v, false)
+				n[i] = RedactedValue
+			} else {
+				redactPath(v, path[1:], redaction)
+			}
+		}
+	}
+}
+
+// Redaction masks a set of known sensitive values within text.
+type Redaction struct {
+	values []string
+	// all masks text entirely, used when the sensitive values aren't known.
+	all bool
+}
+
+func (r *Redaction) add(v interface{}, base64Encoded bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, item := range v {
+			r.add(item, base64Encoded)
+		}
+	case []interface{}:
+		for _, item := range v {
+			r.add(item, base64Encoded)
+		}
+	case nil:
+	default:
+		s := fmt.Sprint(v)
+		if len(s) >= minRedactedLength {
+			r.values = append(r.values, s)
+		}
+
+		if base64Encoded {
+			if decoded, err := base64.StdEncoding.DecodeString(s); err == nil && len(decoded) >= minRedactedLength {
+				r.values = append(r.values, string(decoded))
+			}
+		}
+	}
+}
+
+// sort orders values longest first, so that values containing other values
+// are masked whole.
+func (r *Redaction) sort() {
+	sort.Slice(r.values, func(i, j int) bool {
+		return len(r.values[i]) > len(r.values[j])
+	})
+}
+
+// String masks any sensitive values within s.
+func (r *Redaction) String(s string) string {
+	if r == nil {
+		return s
+	}
+
+	if r.all && s != "" {
+		return RedactedValue
+	}
+
+	for _, v := range r.values {
+		s = strings.ReplaceAll(s, v, RedactedValue)
+	}
+
+	return s
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactor(t *testing.T) {
+	// "aHVudGVyMg==" is "hunter2".
+	manifests := []byte(`apiVersion: v1
+kind: Secret
+metadata:
+  name: creds
+data:
+  password: aHVudGVyMg==
+stringData:
+  token: s3cr3t-token
+---
+apiVersion: example.com/v1
+kind: Database
+metadata:
+  name: db
+spec:
+  users:
+    - name: admin
+      password: correct-horse
+  size: 10
+`)
+
+	redactor := NewRedactor([]string{"spec.users.*.password"})
+
+	redacted, redaction := redactor.Redact(manifests)
+
+	docs, err := SplitManifests(redacted)
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+
+	assert.Equal(t, RedactedValue, docs[0]["data"].(map[string]interface{})["password"])
+	assert.Equal(t, RedactedValue, docs[0]["stringData"].(map[string]interface{})["token"])
+
+	spec := docs[1]["spec"].(map[string]interface{})
+	user := spec["users"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, RedactedValue, user["password"])
+	assert.Equal(t, "admin", user["name"], "Other fields should be left alone")
+	assert.Equal(t, 10, spec["size"])
+
+	for _, secret := range []string{"aHVudGVyMg==", "hunter2", "s3cr3t-token", "correct-horse"} {
+		assert.NotContains(t, string(redacted), secret)
+		assert.NotContains(t, redaction.String("error: value "+secret+" rejected"), secret)
+	}
+
+	t.Run("Invalid YAML", func(t *testing.T) {
+		out, redaction := redactor.Redact([]byte("password: hunter2\nytt: Error: unknown attribute"))
+		assert.Equal(t, RedactedValue, string(out), "Invalid YAML should be masked entirely")
+		assert.Equal(t, RedactedValue, redaction.String("error: value hunter2 rejected"))
+		assert.Empty(t, redaction.String(""))
+	})
+}
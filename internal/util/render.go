@@ -0,0 +1,49 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DataValues encodes an object as a ytt data values document, which is how
+// objects are passed to a reconcilers scripts.
+func DataValues(obj map[string]interface{}) ([]byte, error) {
+	objYAML, err := yaml.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal object: %w", err)
+	}
+
+	return append([]byte("#@data/values\n---\n"), objYAML...), nil
+}
+
+// RenderCommand returns a ytt command that renders the scripts in a
+// directory against the given data values. Both the rendered manifests and
+// any errors are written to out.
+func RenderCommand(yttPath, scriptsDir string, values []byte, out io.Writer) *exec.Cmd {
+	cmd := exec.Command(yttPath, "-f", scriptsDir, "-f", "-")
+	cmd.Stdin = bytes.NewReader(values)
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	return cmd
+}
@@ -0,0 +1,228 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+)
+
+const defaultScriptMode = 0o644
+
+// CleanScriptName validates and normalises the name of a script. Names are
+// slash separated paths relative to the scripts directory.
+func CleanScriptName(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("script name must not be empty")
+	}
+
+	if strings.Contains(name, "\\") || strings.ContainsRune(name, 0) {
+		return "", fmt.Errorf("invalid script name %q: must not contain backslashes or null bytes", name)
+	}
+
+	if path.IsAbs(name) {
+		return "", fmt.Errorf("invalid script name %q: must be a relative path", name)
+	}
+
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("invalid script name %q: must not contain '..'", name)
+		}
+	}
+
+	cleaned := path.Clean(name)
+	if cleaned == "." {
+		return "", fmt.Errorf("invalid script name %q: must name a file", name)
+	}
+
+	return cleaned, nil
+}
+
+// ValidateScripts checks that every script has a valid, unique name and
+// decodable contents.
+func ValidateScripts(scripts []v1beta1.ReconcilerScriptSpec) error {
+	_, err := decodeScripts(scripts)
+	return err
+}
+
+// WriteScripts writes scripts out to a directory, creating any
+// subdirectories as needed.
+func WriteScripts(dir string, scripts []v1beta1.ReconcilerScriptSpec) error {
+	files, err := decodeScripts(scripts)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		filePath := filepath.Join(dir, filepath.FromSlash(f.name))
+
+		if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+			return fmt.Errorf("failed to create directory for script %q: %w", f.name, err)
+		}
+
+		// O_EXCL ensures we never write through something that already exists.
+		file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, f.mode)
+		if err != nil {
+			return fmt.Errorf("failed to create script %q: %w", f.name, err)
+		}
+
+		_, err = file.Write(f.data)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write script %q: %w", f.name, err)
+		}
+
+		// The mode passed to OpenFile is subject to the umask.
+		if err := os.Chmod(filePath, f.mode); err != nil {
+			return fmt.Errorf("failed to set mode of script %q: %w", f.name, err)
+		}
+	}
+
+	return nil
+}
+
+// ReadScripts reads every file in a directory (and its subdirectories) as a
+// script, the reverse of WriteScripts. Hidden files and directories (eg.
+// .git) are skipped.
+func ReadScripts(dir string) ([]v1beta1.ReconcilerScriptSpec, error) {
+	var scripts []v1beta1.ReconcilerScriptSpec
+
+	err := filepath.WalkDir(dir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if filePath != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		if !d.Type().IsRegular() {
+			return fmt.Errorf("script %q is not a regular file", name)
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("failed to stat script %q: %w", name, err)
+		}
+
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to read script %q: %w", name, err)
+		}
+
+		script := v1beta1.ReconcilerScriptSpec{Name: name}
+		if utf8.Valid(data) {
+			script.Content = string(data)
+		} else {
+			script.Encoded = base64.StdEncoding.EncodeToString(data)
+		}
+
+		if mode := int32(info.Mode().Perm()); mode != defaultScriptMode {
+			script.Mode = &mode
+		}
+
+		scripts = append(scripts, script)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return scripts, nil
+}
+
+type scriptFile struct {
+	name string
+	mode os.FileMode
+	data []byte
+}
+
+func decodeScripts(scripts []v1beta1.ReconcilerScriptSpec) ([]scriptFile, error) {
+	files := make([]scriptFile, 0, len(scripts))
+	names := make(map[string]bool, len(scripts))
+
+	for _, s := range scripts {
+		name, err := CleanScriptName(s.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		if names[name] {
+			return nil, fmt.Errorf("duplicate script name %q", name)
+		}
+		names[name] = true
+
+		mode := os.FileMode(defaultScriptMode)
+		if s.Mode != nil {
+			if *s.Mode < 0 || *s.Mode > 0o777 {
+				return nil, fmt.Errorf("invalid mode for script %q: %#o", name, *s.Mode)
+			}
+
+			mode = os.FileMode(*s.Mode)
+		}
+
+		if s.Content != "" && s.Encoded != "" {
+			return nil, fmt.Errorf("script %q must not set both content and encoded", name)
+		}
+
+		data := []byte(s.Content)
+		if s.Encoded != "" {
+			data, err = base64.StdEncoding.DecodeString(s.Encoded)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode script %q: %w", name, err)
+			}
+		}
+
+		files = append(files, scriptFile{name: name, mode: mode, data: data})
+	}
+
+	// A script can't also be a directory containing other scripts.
+	for name := range names {
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			if names[dir] {
+				return nil, fmt.Errorf("script %q conflicts with directory of script %q", dir, name)
+			}
+		}
+	}
+
+	return files, nil
+}
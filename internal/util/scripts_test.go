@@ -0,0 +1,109 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanScriptName(t *testing.T) {
+	valid := map[string]string{
+		"config.yaml":        "config.yaml",
+		"lib/helpers.star":   "lib/helpers.star",
+		"./lib//values.yaml": "lib/values.yaml",
+	}
+
+	for name, expected := range valid {
+		cleaned, err := CleanScriptName(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, expected, cleaned)
+	}
+
+	for _, name := range []string{"", ".", "/etc/passwd", "../../etc/x", "lib/../../x", "lib\\x"} {
+		_, err := CleanScriptName(name)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestWriteScripts(t *testing.T) {
+	encode := func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	}
+
+	t.Run("Nested", func(t *testing.T) {
+		dir := t.TempDir()
+
+		mode := int32(0o600)
+		err := WriteScripts(dir, []v1beta1.ReconcilerScriptSpec{
+			{Name: "config.yaml", Content: "#@ load(\"lib/helpers.star\", \"name\")\n"},
+			{Name: "lib/helpers.star", Encoded: encode("def name(): return \"x\"\nend\n"), Mode: &mode},
+		})
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(filepath.Join(dir, "lib", "helpers.star"))
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "def name()")
+
+		info, err := os.Stat(filepath.Join(dir, "lib", "helpers.star"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, scripts := range [][]v1beta1.ReconcilerScriptSpec{
+			{{Name: "../escape.yaml", Encoded: encode("")}},
+			{{Name: "a.yaml", Encoded: "not base64!"}},
+			{{Name: "a.yaml", Content: "a: 1", Encoded: encode("a: 1")}},
+			{{Name: "a.yaml", Encoded: encode("")}, {Name: "./a.yaml", Encoded: encode("")}},
+			{{Name: "lib", Encoded: encode("")}, {Name: "lib/a.yaml", Encoded: encode("")}},
+		} {
+			dir := t.TempDir()
+
+			assert.Error(t, WriteScripts(dir, scripts))
+
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			assert.Empty(t, entries, "Nothing should be written for invalid scripts")
+		}
+	})
+}
+
+func TestReadScripts(t *testing.T) {
+	dir := t.TempDir()
+
+	mode := int32(0o600)
+	scripts := []v1beta1.ReconcilerScriptSpec{
+		{Name: "config.yaml", Content: "#@ load(\"lib/helpers.star\", \"name\")\n"},
+		{Name: "lib/helpers.star", Content: "def name(): return \"x\"\nend\n", Mode: &mode},
+		{Name: "lib/logo.png", Encoded: base64.StdEncoding.EncodeToString([]byte{0x89, 0x50, 0x4e, 0x47, 0xff})},
+	}
+	require.NoError(t, WriteScripts(dir, scripts))
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".git"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0o644))
+
+	read, err := ReadScripts(dir)
+	require.NoError(t, err)
+	assert.Equal(t, scripts, read, "Reading should be the reverse of writing, skipping hidden files")
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxFieldLocations is the most source locations reported for a field.
+const maxFieldLocations = 5
+
+// LocateField returns the source locations (as file:line) in a scripts
+// directory that might set a field, given its path in a rendered document
+// (eg. spec.template.spec.containers[0].image). Ytt doesn't map rendered
+// documents back to their templates, so we look for lines that set the last
+// key of the path, either as YAML or as a starlark dict entry.
+func LocateField(dir, field string) ([]string, error) {
+	key := field
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		key = key[i+1:]
+	}
+	if i := strings.Index(key, "["); i >= 0 {
+		key = key[:i]
+	}
+
+	if key == "" {
+		return nil, nil
+	}
+
+	pattern := regexp.MustCompile(`^\s*(-\s+)?["']?` + regexp.QuoteMeta(key) + `["']?\s*:`)
+
+	var locations []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !d.Type().IsRegular() || len(locations) == maxFieldLocations {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for line := 1; scanner.Scan(); line++ {
+			if pattern.MatchString(scanner.Text()) {
+				locations = append(locations, fmt.Sprintf("%s:%d", filepath.ToSlash(rel), line))
+				if len(locations) == maxFieldLocations {
+					break
+				}
+			}
+		}
+
+		// Binary files may have lines longer than the scanner allows.
+		if err := scanner.Err(); err != nil && err != bufio.ErrTooLong {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search scripts: %w", err)
+	}
+
+	return locations, nil
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocateField(t *testing.T) {
+	dir := t.TempDir()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "lib"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(`apiVersion: apps/v1
+kind: Deployment
+spec:
+  replicas: #@ data.values.spec.replicas
+  template:
+    spec:
+      containers:
+      - image: nginx
+        imagePullPolicyy: Always
+`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib", "helpers.star"), []byte(`def labels():
+  return {
+    "replicas": 1,
+  }
+end
+`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".hidden.yaml"), []byte("replicas: 2\n"), 0o644))
+
+	locations, err := LocateField(dir, "spec.replicas")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"config.yaml:4", "lib/helpers.star:3"}, locations)
+
+	locations, err = LocateField(dir, "spec.template.spec.containers[0].imagePullPolicyy")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"config.yaml:9"}, locations)
+
+	locations, err = LocateField(dir, "spec.template.spec.containers[0].image")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"config.yaml:8"}, locations, "List items should be matched")
+
+	locations, err = LocateField(dir, "spec.missing")
+	require.NoError(t, err)
+	assert.Empty(t, locations)
+}
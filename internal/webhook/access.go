@@ -0,0 +1,231 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// Verbs the generated RBAC grants a child on its for and output kinds.
+var (
+	forVerbs    = []string{"get", "list", "watch", "update", "patch"}
+	outputVerbs = []string{"get", "list", "watch", "create", "update", "patch", "delete"}
+)
+
+// Verbs the operator uses to install the CRDs of defined kinds.
+var definitionVerbs = []string{"create", "update"}
+
+// validateAccess checks that the user creating (or updating) a reconciler is
+// allowed to do everything the operator (or the generated RBAC of the child)
+// would do on their behalf, otherwise a reconciler could be used to escalate
+// privileges.
+func (v *ReconcilerValidator) validateAccess(ctx context.Context, obj reconcilerObject) field.ErrorList {
+	spec := obj.GetReconcilerSpec()
+	generate := spec.RBAC != nil && spec.RBAC.Generate
+
+	var defines bool
+	for _, t := range spec.For {
+		defines = defines || t.Definition != nil
+	}
+
+	if !generate && !defines {
+		return nil
+	}
+
+	specPath := field.NewPath("spec")
+
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return field.ErrorList{field.InternalError(specPath, fmt.Errorf("unable to determine the requesting user: %w", err))}
+	}
+
+	var errs field.ErrorList
+	if defines {
+		errs = append(errs, v.validateDefinitionAccess(ctx, specPath, req.UserInfo, spec)...)
+	}
+
+	if generate {
+		errs = append(errs, v.validateRBACAccess(ctx, specPath, req.UserInfo, obj)...)
+	}
+
+	return errs
+}
+
+// validateDefinitionAccess checks that the user is allowed to install the CRDs
+// of the kinds a reconciler defines, as the operator installs them with its
+// own cluster wide permissions.
+func (v *ReconcilerValidator) validateDefinitionAccess(ctx context.Context, specPath *field.Path, user authenticationv1.UserInfo, spec *v1beta1.ReconcilerSpec) field.ErrorList {
+	resource := apiextensionsv1.SchemeGroupVersion.WithResource("customresourcedefinitions")
+
+	var denied []string
+	for _, verb := range definitionVerbs {
+		allowed, err := v.allowed(ctx, user, authorizationv1.ResourceAttributes{
+			Verb:     verb,
+			Group:    resource.Group,
+			Resource: resource.Resource,
+		})
+		if err != nil {
+			return field.ErrorList{field.InternalError(specPath.Child("for"), fmt.Errorf("failed to review access: %w", err))}
+		}
+
+		if !allowed {
+			denied = append(denied, verb)
+		}
+	}
+
+	if len(denied) == 0 {
+		return nil
+	}
+
+	var errs field.ErrorList
+	for i, t := range spec.For {
+		if t.Definition == nil {
+			continue
+		}
+
+		errs = append(errs, field.Forbidden(specPath.Child("for").Index(i).Child("definition"),
+			fmt.Sprintf("user %q can't %s %s, so can't define kinds", user.Username, strings.Join(denied, ", "), resource.GroupResource().String())))
+	}
+
+	return errs
+}
+
+// validateRBACAccess checks that the user holds everything the generated RBAC
+// would allow the child to do.
+func (v *ReconcilerValidator) validateRBACAccess(ctx context.Context, specPath *field.Path, user authenticationv1.UserInfo, obj reconcilerObject) field.ErrorList {
+	spec := obj.GetReconcilerSpec()
+
+	var errs field.ErrorList
+
+	for i, t := range spec.For {
+		gvk := t.GroupVersionKind()
+		if gvk.Version == "" || gvk.Kind == "" {
+			continue
+		}
+
+		// Kinds that aren't installed yet will be granted once they are, so
+		// we have to guess their resource.
+		var resource schema.GroupVersionResource
+		namespaced := true
+		if t.Definition != nil {
+			resource = gvk.GroupVersion().WithResource(t.Plural())
+			namespaced = t.Definition.Scope != apiextensionsv1.ClusterScoped
+		} else if mapping, err := v.mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err == nil {
+			resource = mapping.Resource
+			namespaced = mapping.Scope.Name() == meta.RESTScopeNameNamespace
+		} else {
+			resource, _ = meta.UnsafeGuessKindToResource(gvk)
+		}
+
+		errs = append(errs, v.checkAccess(ctx, specPath.Child("for").Index(i), user, obj, resource, namespaced, forVerbs)...)
+	}
+
+	for i, t := range spec.RBAC.Outputs {
+		gvk := t.GroupVersionKind()
+
+		// Unknown kinds are rejected elsewhere.
+		mapping, err := v.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			continue
+		}
+
+		errs = append(errs, v.checkAccess(ctx, specPath.Child("rbac", "outputs").Index(i), user, obj,
+			mapping.Resource, mapping.Scope.Name() == meta.RESTScopeNameNamespace, outputVerbs)...)
+	}
+
+	return errs
+}
+
+// checkAccess checks that the user holds the verbs on a resource, in every
+// namespace the reconciler will be granted it.
+func (v *ReconcilerValidator) checkAccess(ctx context.Context, path *field.Path, user authenticationv1.UserInfo, obj reconcilerObject, resource schema.GroupVersionResource, namespaced bool, verbs []string) field.ErrorList {
+	namespaces := obj.GetWatchedNamespaces()
+	if !namespaced || len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+
+	var errs field.ErrorList
+	for _, ns := range namespaces {
+		var denied []string
+		for _, verb := range verbs {
+			allowed, err := v.allowed(ctx, user, authorizationv1.ResourceAttributes{
+				Namespace: ns,
+				Verb:      verb,
+				Group:     resource.Group,
+				Resource:  resource.Resource,
+			})
+			if err != nil {
+				return append(errs, field.InternalError(path, fmt.Errorf("failed to review access: %w", err)))
+			}
+
+			if !allowed {
+				denied = append(denied, verb)
+			}
+		}
+
+		if len(denied) == 0 {
+			continue
+		}
+
+		where := "in namespace " + ns
+		if ns == "" {
+			where = "cluster wide"
+		}
+
+		errs = append(errs, field.Forbidden(path, fmt.Sprintf("user %q can't %s %s %s, so can't grant it to the reconciler",
+			user.Username, strings.Join(denied, ", "), resource.GroupResource().String(), where)))
+	}
+
+	return errs
+}
+
+// allowed asks the API server whether a user may do something.
+func (v *ReconcilerValidator) allowed(ctx context.Context, user authenticationv1.UserInfo, attrs authorizationv1.ResourceAttributes) (bool, error) {
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for k, values := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(values)
+	}
+
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &attrs,
+			User:               user.Username,
+			UID:                user.UID,
+			Groups:             user.Groups,
+			Extra:              extra,
+		},
+	}
+
+	if err := v.authorizer.Create(ctx, review); err != nil {
+		return false, err
+	}
+
+	return review.Status.Allowed, nil
+}
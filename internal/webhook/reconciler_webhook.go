@@ -0,0 +1,336 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	"github.com/dpeckett/ytt-operator/internal/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
+)
+
+// renderTimeout bounds the trial render, it needs to finish well within the
+// api servers webhook timeout.
+const renderTimeout = 5 * time.Second
+
+// compileError matches ytt errors caused by the templates themselves (rather
+// than by the trial object not having the fields a template expects).
+var compileError = regexp.MustCompile(`(?i)(unmarshaling|compiling|parsing) .*template|syntax error|unknown file type`)
+
+//+kubebuilder:webhook:path=/validate-ytt-operator-pecke-tt-v1beta1-reconciler,mutating=false,failurePolicy=fail,sideEffects=None,groups=ytt-operator.pecke.tt,resources=reconcilers,verbs=create;update,versions=v1beta1,name=vreconciler.ytt-operator.pecke.tt,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-ytt-operator-pecke-tt-v1beta1-clusterreconciler,mutating=false,failurePolicy=fail,sideEffects=None,groups=ytt-operator.pecke.tt,resources=clusterreconcilers,verbs=create;update,versions=v1beta1,name=vclusterreconciler.ytt-operator.pecke.tt,admissionReviewVersions=v1
+
+//+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get
+
+// ReconcilerValidator rejects Reconcilers (and ClusterReconcilers) that would
+// fail once their child starts (eg. undecodable scripts, or templates that
+// don't compile).
+type ReconcilerValidator struct {
+	client client.Reader
+	// authorizer creates the subject access reviews for generated RBAC.
+	authorizer client.Client
+	mapper     meta.RESTMapper
+	yttPath    string
+}
+
+var _ webhook.CustomValidator = &ReconcilerValidator{}
+
+func NewReconcilerValidator(mgr ctrl.Manager) *ReconcilerValidator {
+	return &ReconcilerValidator{
+		client:     mgr.GetAPIReader(),
+		authorizer: mgr.GetClient(),
+		mapper:     mgr.GetRESTMapper(),
+		yttPath:    "ytt",
+	}
+}
+
+func (v *ReconcilerValidator) SetupWithManager(mgr ctrl.Manager) error {
+	server := mgr.GetWebhookServer()
+
+	// Registered by hand (rather than with ctrl.NewWebhookManagedBy) so that
+	// the validator is able to return warnings.
+	server.Register("/validate-ytt-operator-pecke-tt-v1beta1-reconciler", v.webhookFor(&v1beta1.Reconciler{}))
+	server.Register("/validate-ytt-operator-pecke-tt-v1beta1-clusterreconciler", v.webhookFor(&v1beta1.ClusterReconciler{}))
+
+	// Between the v1alpha1 and v1beta1 reconcilers.
+	server.Register("/convert", &conversion.Webhook{})
+
+	return nil
+}
+
+func (v *ReconcilerValidator) webhookFor(obj runtime.Object) *admission.Webhook {
+	hook := admission.WithCustomValidator(obj, v)
+	hook.Handler = &warningHandler{Handler: hook.Handler}
+
+	return hook
+}
+
+func (v *ReconcilerValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	reconciler, err := asReconcilerObject(obj)
+	if err != nil {
+		return err
+	}
+
+	return v.validate(ctx, reconciler)
+}
+
+func (v *ReconcilerValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	oldReconciler, err := asReconcilerObject(oldObj)
+	if err != nil {
+		return err
+	}
+
+	reconciler, err := asReconcilerObject(newObj)
+	if err != nil {
+		return err
+	}
+
+	// Metadata and status changes (eg. removing finalizers) must always be
+	// allowed, even if the spec has since become invalid.
+	if reconciler.GetDeletionTimestamp() != nil ||
+		equality.Semantic.DeepEqual(oldReconciler.GetReconcilerSpec(), reconciler.GetReconcilerSpec()) {
+		return nil
+	}
+
+	return v.validate(ctx, reconciler)
+}
+
+func (v *ReconcilerValidator) ValidateDelete(_ context.Context, _ runtime.Object) error {
+	return nil
+}
+
+func (v *ReconcilerValidator) validate(ctx context.Context, obj reconcilerObject) error {
+	var errs field.ErrorList
+
+	specPath := field.NewPath("spec")
+	spec := obj.GetReconcilerSpec()
+
+	// Kinds defined by this reconciler, by CRD name.
+	defined := map[string]bool{}
+
+	for i, t := range spec.For {
+		forPath := specPath.Child("for").Index(i)
+
+		gvk := t.GroupVersionKind()
+		if gvk.Version == "" || gvk.Kind == "" {
+			errs = append(errs, field.Invalid(forPath, t, "apiVersion and kind are required"))
+			continue
+		}
+
+		// Kinds that aren't installed yet are fine, the child waits for them.
+		if t.Definition != nil {
+			errs = append(errs, validateDefinition(forPath, t, defined)...)
+		} else if _, err := v.mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err != nil && !meta.IsNoMatchError(err) {
+			errs = append(errs, field.InternalError(forPath, err))
+		}
+
+		if t.Selector != nil {
+			if _, err := metav1.LabelSelectorAsSelector(t.Selector); err != nil {
+				errs = append(errs, field.Invalid(forPath.Child("selector"), t.Selector, err.Error()))
+			}
+		}
+	}
+
+	if spec.RBAC != nil {
+		rbacPath := specPath.Child("rbac")
+
+		if spec.RBAC.Generate && spec.ServiceAccountName != "" {
+			errs = append(errs, field.Forbidden(specPath.Child("serviceAccountName"), "must be empty when rbac.generate is set"))
+		}
+
+		for i, t := range spec.RBAC.Outputs {
+			outputPath := rbacPath.Child("outputs").Index(i)
+
+			gvk := t.GroupVersionKind()
+			if gvk.Version == "" || gvk.Kind == "" {
+				errs = append(errs, field.Invalid(outputPath, t, "apiVersion and kind are required"))
+				continue
+			}
+
+			if _, err := v.mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+				if meta.IsNoMatchError(err) {
+					errs = append(errs, field.NotFound(outputPath, gvk.String()))
+				} else {
+					errs = append(errs, field.InternalError(outputPath, err))
+				}
+			}
+		}
+	}
+
+	errs = append(errs, v.validateAccess(ctx, obj)...)
+
+	// Generated service accounts won't exist until the reconciler does.
+	if name := spec.ServiceAccountName; name != "" && (spec.RBAC == nil || !spec.RBAC.Generate) {
+		var sa corev1.ServiceAccount
+		if err := v.client.Get(ctx, types.NamespacedName{Name: name, Namespace: childNamespace(obj)}, &sa); err != nil {
+			if errors.IsNotFound(err) {
+				errs = append(errs, field.NotFound(specPath.Child("serviceAccountName"), name))
+			} else {
+				errs = append(errs, field.InternalError(specPath.Child("serviceAccountName"), err))
+			}
+		}
+	}
+
+	if err := util.ValidateScripts(spec.Scripts); err != nil {
+		errs = append(errs, field.Invalid(specPath.Child("scripts"), field.OmitValueType{}, err.Error()))
+	} else if err := v.trialRender(ctx, obj); err != nil {
+		errs = append(errs, field.Invalid(specPath.Child("scripts"), field.OmitValueType{}, err.Error()))
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	kind := "Reconciler"
+	if _, ok := obj.(*v1beta1.ClusterReconciler); ok {
+		kind = "ClusterReconciler"
+	}
+
+	return errors.NewInvalid(v1beta1.GroupVersion.WithKind(kind).GroupKind(), obj.GetName(), errs)
+}
+
+// validateDefinition checks that a CRD can be created for a defined kind.
+func validateDefinition(forPath *field.Path, t v1beta1.ReconcilerForSpec, defined map[string]bool) field.ErrorList {
+	var errs field.ErrorList
+
+	path := forPath.Child("definition")
+
+	gvk := t.GroupVersionKind()
+	if !strings.Contains(gvk.Group, ".") {
+		errs = append(errs, field.Invalid(forPath.Child("apiVersion"), t.APIVersion, "defined kinds must have a group containing a '.'"))
+	}
+
+	for _, msg := range validation.IsDNS1035Label(t.Plural()) {
+		errs = append(errs, field.Invalid(path.Child("plural"), t.Plural(), msg))
+	}
+
+	name := t.Plural() + "." + gvk.Group
+	if defined[name] {
+		errs = append(errs, field.Duplicate(path, name))
+	}
+	defined[name] = true
+
+	return errs
+}
+
+// trialRender runs the templates against a minimal object of the first For
+// kind. As the object has no spec, only errors in the templates themselves
+// (eg. invalid YAML or Starlark syntax) are reported.
+func (v *ReconcilerValidator) trialRender(ctx context.Context, obj reconcilerObject) error {
+	spec := obj.GetReconcilerSpec()
+	if len(spec.Scripts) == 0 {
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "ytt-operator-webhook")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := util.WriteScripts(dir, spec.Scripts); err != nil {
+		return err
+	}
+
+	trialObj := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":      "trial",
+			"namespace": childNamespace(obj),
+		},
+	}
+	if len(spec.For) > 0 {
+		trialObj["apiVersion"] = spec.For[0].APIVersion
+		trialObj["kind"] = spec.For[0].Kind
+	}
+
+	values, err := util.DataValues(trialObj)
+	if err != nil {
+		return fmt.Errorf("failed to marshal trial object: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, renderTimeout)
+	defer cancel()
+
+	var outBuf bytes.Buffer
+	if err := util.RunCommand(ctx, util.RenderCommand(v.yttPath, dir, values, &outBuf)); err != nil {
+		out := outBuf.String()
+		if compileError.MatchString(out) {
+			return fmt.Errorf("templates failed to compile: %s", strings.TrimSpace(out))
+		}
+
+		// Most likely the templates needed fields our trial object doesn't
+		// have, but it could be a real problem so let the user know.
+		_, redaction := util.NewRedactor(spec.SensitiveFields).Redact(values)
+		message := strings.TrimSpace(out)
+		if message == "" {
+			message = err.Error()
+		}
+
+		log.FromContext(ctx).V(1).Info("Ignoring trial render failure", "error", err.Error(), "output", redaction.String(out))
+		addWarning(ctx, "Trial render of the scripts failed, this is expected if they need fields the trial object doesn't have: "+redaction.String(message))
+	}
+
+	return nil
+}
+
+// reconcilerObject is implemented by both Reconcilers and ClusterReconcilers.
+type reconcilerObject interface {
+	client.Object
+	GetReconcilerSpec() *v1beta1.ReconcilerSpec
+	GetWatchedNamespaces() []string
+}
+
+func asReconcilerObject(obj runtime.Object) (reconcilerObject, error) {
+	switch obj := obj.(type) {
+	case *v1beta1.Reconciler:
+		return obj, nil
+	case *v1beta1.ClusterReconciler:
+		return obj, nil
+	default:
+		return nil, fmt.Errorf("expected a Reconciler or ClusterReconciler but got %T", obj)
+	}
+}
+
+// childNamespace returns the namespace the reconcilers child will run in.
+func childNamespace(obj reconcilerObject) string {
+	if clusterReconciler, ok := obj.(*v1beta1.ClusterReconciler); ok {
+		return clusterReconciler.Spec.Namespace
+	}
+
+	return obj.GetNamespace()
+}
@@ -0,0 +1,267 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/dpeckett/ytt-operator/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestReconcilerValidator(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Database"}, meta.RESTScopeNamespace)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Secret"), meta.RESTScopeNamespace)
+
+	// The trial render is exercised when ytt is available.
+	yttPath := "ytt"
+	if _, err := exec.LookPath(yttPath); err != nil {
+		yttPath = "true"
+	}
+
+	v := &ReconcilerValidator{
+		client: fake.NewClientBuilder().WithObjects(&corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{Name: "databases", Namespace: "default"},
+		}).Build(),
+		authorizer: &reviewer{denied: map[string]bool{}},
+		mapper:     mapper,
+		yttPath:    yttPath,
+	}
+
+	valid := func() *v1beta1.Reconciler {
+		return &v1beta1.Reconciler{
+			ObjectMeta: metav1.ObjectMeta{Name: "databases", Namespace: "default"},
+			Spec: v1beta1.ReconcilerSpec{
+				ServiceAccountName: "databases",
+				For:                []v1beta1.ReconcilerForSpec{{APIVersion: "example.com/v1", Kind: "Database"}},
+				Scripts: []v1beta1.ReconcilerScriptSpec{{
+					Name:    "config.yaml",
+					Content: "#@ load(\"@ytt:data\", \"data\")\n",
+				}},
+			},
+		}
+	}
+
+	ctx := context.Background()
+
+	// Generated RBAC is checked against the user making the request.
+	requestCtx := admission.NewContextWithRequest(ctx, admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		UserInfo: authenticationv1.UserInfo{Username: "developer", Groups: []string{"system:authenticated"}},
+	}})
+
+	t.Run("Valid", func(t *testing.T) {
+		assert.NoError(t, v.ValidateCreate(ctx, valid()))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		obj := valid()
+		obj.Spec.ServiceAccountName = "missing"
+		obj.Spec.For = append(obj.Spec.For, v1beta1.ReconcilerForSpec{APIVersion: "example.com/v1", Kind: "Missing"})
+		obj.Spec.Scripts = append(obj.Spec.Scripts, v1beta1.ReconcilerScriptSpec{Name: "../escape.yaml"})
+
+		err := v.ValidateCreate(ctx, obj)
+		require.True(t, errors.IsInvalid(err))
+
+		status := err.(errors.APIStatus).Status()
+		var fields []string
+		for _, cause := range status.Details.Causes {
+			fields = append(fields, cause.Field)
+		}
+		assert.ElementsMatch(t, []string{"spec.serviceAccountName", "spec.scripts"}, fields,
+			"Kinds that aren't installed yet should be allowed")
+	})
+
+	t.Run("Generated RBAC", func(t *testing.T) {
+		obj := valid()
+		obj.Spec.RBAC = &v1beta1.ReconcilerRBACSpec{
+			Generate: true,
+			Outputs:  []v1beta1.ReconcilerKindSpec{{APIVersion: "example.com/v1", Kind: "Missing"}},
+		}
+
+		err := v.ValidateCreate(requestCtx, obj)
+		require.True(t, errors.IsInvalid(err))
+
+		status := err.(errors.APIStatus).Status()
+		var fields []string
+		for _, cause := range status.Details.Causes {
+			fields = append(fields, cause.Field)
+		}
+		assert.ElementsMatch(t, []string{"spec.serviceAccountName", "spec.rbac.outputs[0]"}, fields)
+
+		obj.Spec.ServiceAccountName = ""
+		obj.Spec.RBAC.Outputs = nil
+		assert.NoError(t, v.ValidateCreate(requestCtx, obj))
+
+		assert.Error(t, v.ValidateCreate(ctx, obj), "Generated RBAC can't be checked without knowing who is asking")
+	})
+
+	t.Run("Privilege escalation", func(t *testing.T) {
+		v := *v
+		v.authorizer = &reviewer{denied: map[string]bool{"secrets": true}}
+
+		obj := valid()
+		obj.Spec.ServiceAccountName = ""
+		obj.Spec.Namespaces = []string{"team-a", "team-b"}
+		obj.Spec.RBAC = &v1beta1.ReconcilerRBACSpec{
+			Generate: true,
+			Outputs: []v1beta1.ReconcilerKindSpec{
+				{APIVersion: "example.com/v1", Kind: "Database"},
+				{APIVersion: "v1", Kind: "Secret"},
+			},
+		}
+
+		err := v.ValidateCreate(requestCtx, obj)
+		require.True(t, errors.IsInvalid(err))
+
+		causes := err.(errors.APIStatus).Status().Details.Causes
+		require.Len(t, causes, 2, "Each namespace should be reported")
+		for _, cause := range causes {
+			assert.Equal(t, "spec.rbac.outputs[1]", cause.Field)
+			assert.Contains(t, cause.Message, `user "developer" can't get, list, watch, create, update, patch, delete secrets`)
+		}
+	})
+
+	t.Run("Defined kinds", func(t *testing.T) {
+		obj := valid()
+		obj.Spec.For = []v1beta1.ReconcilerForSpec{
+			{APIVersion: "example.com/v1", Kind: "Cache", Definition: &v1beta1.ReconcilerDefinitionSpec{}},
+		}
+
+		assert.NoError(t, v.ValidateCreate(requestCtx, obj), "Defined kinds don't need to exist yet")
+		assert.Error(t, v.ValidateCreate(ctx, obj), "Defining kinds can't be checked without knowing who is asking")
+
+		obj.Spec.For = append(obj.Spec.For,
+			v1beta1.ReconcilerForSpec{APIVersion: "example.com/v2", Kind: "Cache", Definition: &v1beta1.ReconcilerDefinitionSpec{}},
+			v1beta1.ReconcilerForSpec{APIVersion: "v1", Kind: "Thing", Definition: &v1beta1.ReconcilerDefinitionSpec{Plural: "Things"}},
+		)
+
+		err := v.ValidateCreate(requestCtx, obj)
+		require.True(t, errors.IsInvalid(err))
+
+		status := err.(errors.APIStatus).Status()
+		var fields []string
+		for _, cause := range status.Details.Causes {
+			fields = append(fields, cause.Field)
+		}
+		assert.ElementsMatch(t, []string{"spec.for[1].definition", "spec.for[2].apiVersion", "spec.for[2].definition.plural"}, fields)
+	})
+
+	t.Run("Defined kinds without CRD access", func(t *testing.T) {
+		v := *v
+		v.authorizer = &reviewer{denied: map[string]bool{"customresourcedefinitions": true}}
+
+		obj := valid()
+		obj.Spec.For = []v1beta1.ReconcilerForSpec{
+			{APIVersion: "example.com/v1", Kind: "Cache", Definition: &v1beta1.ReconcilerDefinitionSpec{}},
+		}
+
+		err := v.ValidateCreate(requestCtx, obj)
+		require.True(t, errors.IsInvalid(err), "The operator installs CRDs with its own permissions")
+
+		causes := err.(errors.APIStatus).Status().Details.Causes
+		require.Len(t, causes, 1)
+		assert.Equal(t, "spec.for[0].definition", causes[0].Field)
+		assert.Contains(t, causes[0].Message, `user "developer" can't create, update customresourcedefinitions.apiextensions.k8s.io`)
+	})
+
+	t.Run("Unchanged spec", func(t *testing.T) {
+		obj := valid()
+		obj.Spec.ServiceAccountName = "missing"
+
+		updated := obj.DeepCopy()
+		updated.Finalizers = nil
+
+		assert.NoError(t, v.ValidateUpdate(ctx, obj, updated), "Updates that don't touch the spec should be allowed")
+	})
+
+	t.Run("ClusterReconciler", func(t *testing.T) {
+		obj := &v1beta1.ClusterReconciler{
+			ObjectMeta: metav1.ObjectMeta{Name: "databases"},
+			Spec: v1beta1.ClusterReconcilerSpec{
+				ReconcilerSpec: valid().Spec,
+				Namespace:      "default",
+			},
+		}
+
+		assert.NoError(t, v.ValidateCreate(ctx, obj))
+
+		// The service account is looked up in the childs namespace.
+		obj.Spec.Namespace = "other"
+		err := v.ValidateCreate(ctx, obj)
+		require.True(t, errors.IsInvalid(err))
+		assert.Equal(t, "ClusterReconciler", err.(errors.APIStatus).Status().Details.Kind)
+	})
+
+	t.Run("Trial render warning", func(t *testing.T) {
+		// Stands in for ytt, failing in a way that doesn't look like a compile error.
+		yttPath := filepath.Join(t.TempDir(), "ytt")
+		require.NoError(t, os.WriteFile(yttPath, []byte("#!/bin/sh\necho \"ytt: Error: struct has no .spec attribute\"\nexit 1\n"), 0o755))
+
+		v := *v
+		v.yttPath = yttPath
+
+		scheme := runtime.NewScheme()
+		require.NoError(t, v1beta1.AddToScheme(scheme))
+
+		hook := v.webhookFor(&v1beta1.Reconciler{})
+		require.NoError(t, hook.InjectScheme(scheme))
+
+		raw, err := json.Marshal(valid())
+		require.NoError(t, err)
+
+		resp := hook.Handle(ctx, admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		}})
+		assert.True(t, resp.Allowed)
+		require.Len(t, resp.Warnings, 1)
+		assert.Contains(t, resp.Warnings[0], "struct has no .spec attribute")
+	})
+}
+
+// reviewer answers subject access reviews, allowing everything other than
+// the denied resources.
+type reviewer struct {
+	client.Client
+	denied map[string]bool
+}
+
+func (r *reviewer) Create(_ context.Context, obj client.Object, _ ...client.CreateOption) error {
+	review := obj.(*authorizationv1.SubjectAccessReview)
+	review.Status.Allowed = !r.denied[review.Spec.ResourceAttributes.Resource]
+
+	return nil
+}
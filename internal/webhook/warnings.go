@@ -0,0 +1,73 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhook
+
+import (
+	"context"
+	"sync"
+
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// CustomValidators have no way of returning admission warnings (before
+// controller-runtime v0.15), so they are collected through the context.
+type warningsKey struct{}
+
+type warnings struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+// addWarning adds a warning to the admission response, it is dropped if the
+// validator wasn't called by a warningHandler (eg. in tests).
+func addWarning(ctx context.Context, message string) {
+	w, ok := ctx.Value(warningsKey{}).(*warnings)
+	if !ok {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.messages = append(w.messages, message)
+}
+
+// warningHandler adds the warnings collected while handling a request to
+// its response.
+type warningHandler struct {
+	admission.Handler
+}
+
+func (h *warningHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	w := &warnings{}
+	resp := h.Handler.Handle(context.WithValue(ctx, warningsKey{}, w), req)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.messages) > 0 {
+		resp = resp.WithWarnings(w.messages...)
+	}
+
+	return resp
+}
+
+// InjectDecoder passes the decoder on to the wrapped handler.
+func (h *warningHandler) InjectDecoder(d *admission.Decoder) error {
+	_, err := admission.InjectDecoderInto(d, h.Handler)
+	return err
+}
@@ -0,0 +1,382 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package rendertest runs a reconcilers scripts against sample objects, and
+// compares the rendered manifests to the expected (golden) manifests. It
+// needs ytt, but no cluster.
+//
+// Each test case is a directory containing:
+//
+//	object.yaml      The object to render.
+//	expected.yaml    The expected manifests (written when updating).
+//	assertions.yaml  Optional assertions on specific documents.
+//	error.txt        Optional, the render is expected to fail with an error
+//	                 containing this text.
+package rendertest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dpeckett/ytt-operator/internal/controller"
+	"github.com/dpeckett/ytt-operator/internal/util"
+	"github.com/pmezard/go-difflib/difflib"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// ObjectFile is the object a case renders.
+	ObjectFile = "object.yaml"
+	// ExpectedFile is the expected output of a case.
+	ExpectedFile = "expected.yaml"
+	// AssertionsFile holds assertions on specific documents of the output.
+	AssertionsFile = "assertions.yaml"
+	// ErrorFile marks a case as expected to fail, it holds text the error
+	// must contain.
+	ErrorFile = "error.txt"
+)
+
+// Options configure how cases are run.
+type Options struct {
+	// YTTPath is the path to the ytt binary (default "ytt").
+	YTTPath string
+	// Kinds are the kinds the scripts are for (eg. a reconcilers for kinds),
+	// objects of any other kind fail. If empty, any kind is allowed.
+	Kinds []schema.GroupVersionKind
+	// Update writes the rendered output to each cases expected manifests,
+	// rather than comparing against them.
+	Update bool
+}
+
+// Result is the outcome of a case.
+type Result struct {
+	// Name is the name of the cases directory.
+	Name string
+	// Failures describe why the case failed, it passed if there are none.
+	Failures []string
+	// Updated is true if the expected manifests were written.
+	Updated bool
+}
+
+// Passed returns true if the case passed.
+func (r *Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+func (r *Result) fail(format string, args ...interface{}) {
+	r.Failures = append(r.Failures, fmt.Sprintf(format, args...))
+}
+
+// Assertion checks the documents of the output that match it. Empty
+// selector fields match anything.
+type Assertion struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Name       string `yaml:"name"`
+	Namespace  string `yaml:"namespace"`
+	// Count is the number of documents that must match, 0 asserts that no
+	// documents match. By default at least one must match.
+	Count *int `yaml:"count"`
+	// Fields are the expected values of fields in every matching document.
+	// Paths are dot separated (eg. "spec.template.spec.containers.0.image").
+	Fields map[string]interface{} `yaml:"fields"`
+}
+
+// String describes the documents the assertion matches.
+func (a *Assertion) String() string {
+	var parts []string
+	for _, part := range []string{a.APIVersion, a.Kind, a.Namespace, a.Name} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	if len(parts) == 0 {
+		return "any document"
+	}
+
+	return strings.Join(parts, "/")
+}
+
+func (a *Assertion) matches(doc map[string]interface{}) bool {
+	obj := unstructured.Unstructured{Object: doc}
+
+	return (a.APIVersion == "" || a.APIVersion == obj.GetAPIVersion()) &&
+		(a.Kind == "" || a.Kind == obj.GetKind()) &&
+		(a.Name == "" || a.Name == obj.GetName()) &&
+		(a.Namespace == "" || a.Namespace == obj.GetNamespace())
+}
+
+func (a *Assertion) check(result *Result, docs []map[string]interface{}) {
+	var matched []map[string]interface{}
+	for _, doc := range docs {
+		if a.matches(doc) {
+			matched = append(matched, doc)
+		}
+	}
+
+	if a.Count != nil && len(matched) != *a.Count {
+		result.fail("expected %d documents matching %s, found %d", *a.Count, a, len(matched))
+		return
+	} else if a.Count == nil && len(matched) == 0 {
+		result.fail("expected documents matching %s, found none", a)
+		return
+	}
+
+	paths := make([]string, 0, len(a.Fields))
+	for path := range a.Fields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, doc := range matched {
+		obj := unstructured.Unstructured{Object: doc}
+		for _, path := range paths {
+			value, found := lookup(doc, strings.Split(path, "."))
+			if !found {
+				result.fail("%s %s: %s is not set", obj.GetKind(), obj.GetName(), path)
+			} else if !reflect.DeepEqual(value, a.Fields[path]) {
+				result.fail("%s %s: expected %s to be %v, got %v", obj.GetKind(), obj.GetName(), path, a.Fields[path], value)
+			}
+		}
+	}
+}
+
+// lookup returns the value of a field, list elements are selected by index.
+func lookup(node interface{}, path []string) (interface{}, bool) {
+	for _, segment := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if node, ok = n[segment]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, false
+			}
+			node = n[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return node, true
+}
+
+// Run runs every case in a directory (each subdirectory containing an
+// object) against the scripts in scriptsDir.
+func Run(ctx context.Context, scriptsDir, casesDir string, opts Options) ([]Result, error) {
+	entries, err := os.ReadDir(casesDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cases: %w", err)
+	}
+
+	var results []Result
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		dir := filepath.Join(casesDir, entry.Name())
+		if _, err := os.Stat(filepath.Join(dir, ObjectFile)); err != nil {
+			continue
+		}
+
+		results = append(results, RunCase(ctx, scriptsDir, dir, opts))
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no cases found in %s", casesDir)
+	}
+
+	return results, nil
+}
+
+// RunCase runs a single case against the scripts in scriptsDir.
+func RunCase(ctx context.Context, scriptsDir, dir string, opts Options) Result {
+	result := Result{Name: filepath.Base(dir)}
+
+	obj, err := util.ReadObject(filepath.Join(dir, ObjectFile))
+	if err != nil {
+		result.fail("%v", err)
+		return result
+	}
+
+	if len(opts.Kinds) > 0 && !containsKind(opts.Kinds, obj.GroupVersionKind()) {
+		result.fail("the scripts are not for %s", obj.GroupVersionKind().String())
+		return result
+	}
+
+	expectedErr, err := readOptional(dir, ErrorFile)
+	if err != nil {
+		result.fail("%v", err)
+		return result
+	}
+
+	var assertions []Assertion
+	if data, err := readOptional(dir, AssertionsFile); err != nil {
+		result.fail("%v", err)
+		return result
+	} else if data != nil {
+		if err := yaml.Unmarshal(data, &assertions); err != nil {
+			result.fail("failed to decode %s: %v", AssertionsFile, err)
+			return result
+		}
+	}
+
+	yttPath := opts.YTTPath
+	if yttPath == "" {
+		yttPath = "ytt"
+	}
+
+	out, renderErr := controller.Render(ctx, yttPath, scriptsDir, obj)
+
+	if expectedErr != nil {
+		want := strings.TrimSpace(string(expectedErr))
+		if renderErr == nil {
+			result.fail("expected rendering to fail with %q, but it succeeded", want)
+		} else if !strings.Contains(renderErr.Error(), want) {
+			result.fail("expected rendering to fail with %q, got: %v", want, renderErr)
+		}
+
+		return result
+	}
+
+	if renderErr != nil {
+		result.fail("%v", renderErr)
+		return result
+	}
+
+	docs, err := util.SplitManifests(out)
+	if err != nil {
+		result.fail("%v", err)
+		return result
+	}
+
+	// Both sides are normalised, so only meaningful differences are reported.
+	actual, err := util.JoinManifests(docs)
+	if err != nil {
+		result.fail("%v", err)
+		return result
+	}
+
+	expectedPath := filepath.Join(dir, ExpectedFile)
+	if opts.Update {
+		if err := os.WriteFile(expectedPath, actual, 0o644); err != nil {
+			result.fail("failed to update %s: %v", ExpectedFile, err)
+			return result
+		}
+
+		result.Updated = true
+	} else if expected, err := readOptional(dir, ExpectedFile); err != nil {
+		result.fail("%v", err)
+	} else if expected == nil && len(assertions) == 0 {
+		result.fail("%s is missing, run with update to create it", ExpectedFile)
+	} else if expected != nil {
+		if diff, err := diffManifests(expected, actual); err != nil {
+			result.fail("%v", err)
+		} else if diff != "" {
+			result.fail("output differs from %s:\n%s", ExpectedFile, diff)
+		}
+	}
+
+	for i := range assertions {
+		assertions[i].check(&result, docs)
+	}
+
+	return result
+}
+
+// Test runs every case in casesDir as a subtest, for use in go tests of
+// template repositories.
+func Test(t *testing.T, scriptsDir, casesDir string, opts Options) {
+	t.Helper()
+
+	results, err := Run(context.Background(), scriptsDir, casesDir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, result := range results {
+		result := result
+		t.Run(result.Name, func(t *testing.T) {
+			for _, failure := range result.Failures {
+				t.Error(failure)
+			}
+		})
+	}
+}
+
+// diffManifests returns a unified diff of the expected and actual manifests,
+// or an empty string if they are equivalent.
+func diffManifests(expected, actual []byte) (string, error) {
+	docs, err := util.SplitManifests(expected)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode %s: %w", ExpectedFile, err)
+	}
+
+	expected, err = util.JoinManifests(docs)
+	if err != nil {
+		return "", err
+	}
+
+	if bytes.Equal(expected, actual) {
+		return "", nil
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(expected)),
+		B:        difflib.SplitLines(string(actual)),
+		FromFile: "expected",
+		ToFile:   "actual",
+		Context:  3,
+	})
+}
+
+// readOptional reads a file of a case, returning nil if it doesn't exist.
+func readOptional(dir, name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	return data, nil
+}
+
+func containsKind(kinds []schema.GroupVersionKind, gvk schema.GroupVersionKind) bool {
+	for _, kind := range kinds {
+		if kind == gvk {
+			return true
+		}
+	}
+
+	return false
+}
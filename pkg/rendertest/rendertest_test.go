@@ -0,0 +1,145 @@
+/*
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rendertest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+
+	// A stand in for ytt that echoes back the data values it was given, and
+	// fails for objects that ask it to.
+	yttPath := filepath.Join(dir, "ytt")
+	require.NoError(t, os.WriteFile(yttPath, []byte(`#!/bin/sh
+input=$(cat)
+case "$input" in
+  *fail*) echo "boom" >&2; exit 1 ;;
+esac
+echo "$input"
+`), 0o755))
+
+	writeCase := func(name string, files map[string]string) string {
+		caseDir := filepath.Join(dir, "cases", name)
+		require.NoError(t, os.MkdirAll(caseDir, 0o755))
+
+		for file, content := range files {
+			require.NoError(t, os.WriteFile(filepath.Join(caseDir, file), []byte(content), 0o644))
+		}
+
+		return caseDir
+	}
+
+	object := `apiVersion: example.com/v1
+kind: Database
+metadata:
+  name: my-db
+spec:
+  replicas: 3
+`
+
+	writeCase("passing", map[string]string{
+		ObjectFile: object,
+		ExpectedFile: `apiVersion: example.com/v1
+kind: Database
+metadata:
+  name: my-db
+  finalizers: [ytt-operator.damian.pecke.tt]
+spec: {replicas: 3}
+`,
+		AssertionsFile: `- kind: Database
+  name: my-db
+  fields:
+    spec.replicas: 3
+    metadata.finalizers.0: ytt-operator.damian.pecke.tt
+- kind: Secret
+  count: 0
+`,
+	})
+	writeCase("failing", map[string]string{
+		ObjectFile:   "apiVersion: example.com/v1\nkind: Database\nmetadata:\n  name: fail\n",
+		ErrorFile:    "boom\n",
+		ExpectedFile: "",
+	})
+	writeCase(".hidden", map[string]string{ObjectFile: object})
+
+	ctx := context.Background()
+	opts := Options{YTTPath: yttPath, Kinds: []schema.GroupVersionKind{{Group: "example.com", Version: "v1", Kind: "Database"}}}
+
+	results, err := Run(ctx, dir, filepath.Join(dir, "cases"), opts)
+	require.NoError(t, err)
+	require.Len(t, results, 2, "Hidden directories should be skipped")
+	for _, result := range results {
+		assert.True(t, result.Passed(), "%s: %v", result.Name, result.Failures)
+	}
+
+	t.Run("Mismatch", func(t *testing.T) {
+		caseDir := writeCase("mismatch", map[string]string{
+			ObjectFile:     object,
+			ExpectedFile:   "apiVersion: example.com/v1\nkind: Database\nmetadata:\n  name: other-db\n",
+			AssertionsFile: "- kind: Database\n  fields:\n    spec.replicas: 5\n- kind: Secret\n",
+		})
+
+		result := RunCase(ctx, dir, caseDir, opts)
+		require.Len(t, result.Failures, 3)
+		assert.Contains(t, result.Failures[0], "+  name: my-db")
+		assert.Contains(t, result.Failures[1], "expected spec.replicas to be 5, got 3")
+		assert.Contains(t, result.Failures[2], "Secret")
+	})
+
+	t.Run("Unexpected success", func(t *testing.T) {
+		caseDir := writeCase("unexpected-success", map[string]string{ObjectFile: object, ErrorFile: "boom"})
+
+		result := RunCase(ctx, dir, caseDir, opts)
+		assert.False(t, result.Passed())
+	})
+
+	t.Run("Other kind", func(t *testing.T) {
+		caseDir := writeCase("other-kind", map[string]string{ObjectFile: "apiVersion: example.com/v1\nkind: Cache\nmetadata:\n  name: my-cache\n"})
+
+		result := RunCase(ctx, dir, caseDir, opts)
+		assert.False(t, result.Passed())
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		caseDir := writeCase("new", map[string]string{ObjectFile: object})
+
+		result := RunCase(ctx, dir, caseDir, opts)
+		assert.False(t, result.Passed(), "Cases without expected output should fail")
+
+		updateOpts := opts
+		updateOpts.Update = true
+		result = RunCase(ctx, dir, caseDir, updateOpts)
+		require.True(t, result.Passed(), result.Failures)
+		assert.True(t, result.Updated)
+
+		result = RunCase(ctx, dir, caseDir, opts)
+		assert.True(t, result.Passed(), result.Failures)
+
+		expected, err := os.ReadFile(filepath.Join(caseDir, ExpectedFile))
+		require.NoError(t, err)
+		assert.Contains(t, string(expected), "name: my-db")
+	})
+}